@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// History is kept in two keys per vault: a sorted set of hours (each member is
+// the hour itself, so the set is only an index) and a hash of binary points
+// keyed by hour. Upserts touch one field and one member; reads fetch a range of
+// hours and then the points in bulk.
+
+// historyKey returns the sorted set of history hours for a vault.
+func historyKey(vaultID string) string {
+	return RedisHistoryKey + ":" + vaultID
+}
+
+// pointsKey returns the hash of encoded history points for a vault.
+func pointsKey(vaultID string) string {
+	return RedisPointsKey + ":" + vaultID
+}
+
+// migrateBatch is how many legacy members are converted per transaction.
+const migrateBatch = 500
+
+// hmgetBatch bounds the fields fetched per HMGET.
+const hmgetBatch = 1000
+
+// upsertHistoryScript replaces the point for one hour unless the stored point
+// was read at a later block, so concurrent writers settle on the newest read.
+// KEYS are the hours and points keys; ARGV is the hour, the encoded point and
+// its block. The stored block is the big-endian uint64 after the version byte.
+var upsertHistoryScript = redis.NewScript(`
+local cur = redis.call('HGET', KEYS[2], ARGV[1])
+if cur and string.len(cur) >= 9 then
+	local stored = 0
+	for i = 2, 9 do
+		stored = stored * 256 + string.byte(cur, i)
+	end
+	if stored > tonumber(ARGV[3]) then
+		return 0
+	end
+end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[1])
+return 1
+`)
+
+// cleanupHistoryScript drops every hour before ARGV[1] from both keys.
+var cleanupHistoryScript = redis.NewScript(`
+local hours = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+for i = 1, #hours, 500 do
+	redis.call('HDEL', KEYS[2], unpack(hours, i, math.min(i + 499, #hours)))
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+return #hours
+`)
+
+// AddHistoricalRate stores rate as its hour's point in one atomic step. A point
+// read at an earlier block than the stored one is ignored; equal blocks overwrite,
+// so retries and reorg rewrites are idempotent.
+func (c *Cache) AddHistoricalRate(vaultID string, rate models.RateUpdate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	rate.Timestamp = hourStart(rate.Timestamp)
+	return upsertHistoryScript.Run(ctx, c.client, []string{historyKey(vaultID), pointsKey(vaultID)},
+		rate.Timestamp, encodePoint(rate), rate.BlockNumber).Err()
+}
+
+func (c *Cache) GetHistoricalRates(vaultID string, from, to int64) ([]models.RateUpdate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hours, err := c.client.ZRangeByScore(ctx, historyKey(vaultID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from, 10),
+		Max: strconv.FormatInt(to, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	rates := make([]models.RateUpdate, 0, len(hours))
+	for i := 0; i < len(hours); i += hmgetBatch {
+		vals, err := c.client.HMGet(ctx, pointsKey(vaultID), hours[i:min(i+hmgetBatch, len(hours))]...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vals {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			rate, err := decodePoint([]byte(s))
+			if err != nil {
+				continue
+			}
+			rates = append(rates, rate)
+		}
+	}
+	log.Printf("[GetHistoricalRates] Returning %d hourly points for %s from %d to %d", len(rates), vaultID, from, to)
+	return rates, nil
+}
+
+func (c *Cache) CleanupOldRates(vaultID string, cutoff int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return cleanupHistoryScript.Run(ctx, c.client, []string{historyKey(vaultID), pointsKey(vaultID)},
+		fmt.Sprintf("(%d", cutoff)).Err()
+}
+
+func (c *Cache) GetLastHistoricalTimestamp(vaultID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	res, err := c.client.ZRevRangeWithScores(ctx, historyKey(vaultID), 0, 0).Result()
+	if err != nil || len(res) == 0 {
+		return 0, err
+	}
+	return int64(res[0].Score), nil
+}
+
+// MigrateHistory converts a vault's history from the old layout, where each
+// member of the sorted set was a JSON point, to the hours set and points hash.
+// Each legacy member is upserted and removed in one transaction, so the
+// migration can be interrupted and rerun. It returns how many members it converted.
+// History under the unsuffixed single-vault key is only covered once
+// MigrateLegacyKeys has merged it into the vault's key, so run that first.
+func (c *Cache) MigrateHistory(vaultID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	members, err := c.client.ZRange(ctx, historyKey(vaultID), 0, -1).Result()
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+	var legacy []string
+	for _, m := range members {
+		if strings.HasPrefix(m, "{") {
+			legacy = append(legacy, m)
+		}
+	}
+	keys := []string{historyKey(vaultID), pointsKey(vaultID)}
+	converted := 0
+	for i := 0; i < len(legacy); i += migrateBatch {
+		batch := legacy[i:min(i+migrateBatch, len(legacy))]
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, m := range batch {
+				var rate models.RateUpdate
+				if err := json.Unmarshal([]byte(m), &rate); err == nil {
+					rate.Timestamp = hourStart(rate.Timestamp)
+					upsertHistoryScript.Eval(ctx, pipe, keys, rate.Timestamp, encodePoint(rate), rate.BlockNumber)
+				}
+				pipe.ZRem(ctx, historyKey(vaultID), m)
+			}
+			return nil
+		})
+		cancel()
+		if err != nil {
+			return converted, err
+		}
+		converted += len(batch)
+	}
+	if converted > 0 {
+		log.Printf("[MigrateHistory] Converted %d history points for %s", converted, vaultID)
+	}
+	return converted, nil
+}
@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Zarathos94/puffer/models"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestAddHistoricalRateConcurrentWritersKeepHighestBlock(t *testing.T) {
+	c, _ := newTestCache(t)
+	const writers, writes = 50, 20
+	const hour = int64(7200)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				// Spread writes across the hour and interleave blocks so that lower
+				// blocks keep arriving after higher ones
+				block := uint64((w*writes + i*7919) % (writers * writes))
+				rate := models.RateUpdate{Timestamp: hour + int64(i*97%3600), Rate: float64(block), BlockNumber: block}
+				if err := c.AddHistoricalRate("v", rate); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	ctx := context.Background()
+	members, err := c.client.ZRange(ctx, historyKey("v"), 0, -1).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 {
+		t.Fatalf("got %d members for one hour, want 1: %v", len(members), members)
+	}
+	if n := c.client.HLen(ctx, pointsKey("v")).Val(); n != 1 {
+		t.Fatalf("got %d points, want 1", n)
+	}
+	points, err := c.GetHistoricalRates("v", 0, hour+3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := uint64(writers*writes - 1)
+	if len(points) != 1 || points[0].BlockNumber != want || points[0].Rate != float64(want) || points[0].Timestamp != hour {
+		t.Fatalf("got %+v, want one point at hour %d from block %d", points, hour, want)
+	}
+}
+
+func TestAddHistoricalRateLastWriterWins(t *testing.T) {
+	c, _ := newTestCache(t)
+	steps := []struct {
+		block uint64
+		rate  float64
+		want  float64
+	}{
+		{block: 10, rate: 1, want: 1},
+		{block: 9, rate: 2, want: 1},  // older read is dropped
+		{block: 10, rate: 3, want: 3}, // same block overwrites, e.g. a reorg rewrite
+		{block: 11, rate: 4, want: 4},
+		{block: 0, rate: 5, want: 4}, // event backfill never replaces a block read
+	}
+	for _, s := range steps {
+		if err := c.AddHistoricalRate("v", models.RateUpdate{Timestamp: 3600, Rate: s.rate, BlockNumber: s.block}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.GetHistoricalRates("v", 3600, 3600)
+		if err != nil || len(got) != 1 || got[0].Rate != s.want {
+			t.Fatalf("after block %d: got %+v, %v; want rate %v", s.block, got, err, s.want)
+		}
+	}
+}
+
+// jsonUpsertScript is the upsert for the previous layout, where every member of
+// the history set was a JSON point scored by its hour. It is kept here so the
+// benchmarks can compare the two layouts.
+var jsonUpsertScript = redis.NewScript(`
+local incoming = tonumber(ARGV[3])
+for _, member in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], ARGV[1], ARGV[1])) do
+	local ok, point = pcall(cjson.decode, member)
+	if ok and type(point) == 'table' and (tonumber(point['block_number']) or 0) > incoming then
+		return 0
+	end
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], ARGV[1], ARGV[1])
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+func addJSONPoint(c *Cache, vaultID string, rate models.RateUpdate) error {
+	rate.Timestamp = hourStart(rate.Timestamp)
+	b, err := json.Marshal(rate)
+	if err != nil {
+		return err
+	}
+	return jsonUpsertScript.Run(context.Background(), c.client, []string{historyKey(vaultID)},
+		rate.Timestamp, b, rate.BlockNumber).Err()
+}
+
+func getJSONPoints(c *Cache, vaultID string, from, to int64) ([]models.RateUpdate, error) {
+	members, err := c.client.ZRangeByScore(context.Background(), historyKey(vaultID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from, 10),
+		Max: strconv.FormatInt(to, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	rates := make([]models.RateUpdate, 0, len(members))
+	for _, m := range members {
+		var rate models.RateUpdate
+		if err := json.Unmarshal([]byte(m), &rate); err == nil {
+			rates = append(rates, rate)
+		}
+	}
+	return rates, nil
+}
+
+// benchPoint is a fully populated point, as the updater writes them.
+func benchPoint(hour int64, block uint64) models.RateUpdate {
+	return models.RateUpdate{
+		Timestamp: hour, Rate: 1.0274771024, Assets: "481.25K", TotalSupply: "468.39K",
+		AssetsWei: "481253912345678901234567", TotalSupplyWei: "468387123456789012345678",
+		AssetsPerShare: "1027477102414654454", SharesPerAsset: "973258912345678901",
+		RateDecimal: "1.027477102414654454", BlockNumber: block, BlockTime: hour + 3587,
+		BlockHash:      "0x9f1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c",
+		Implementation: "0x39ca0a6438b6050ea2ac909ba65920c7451305c1", Status: models.StatusConfirmed,
+	}
+}
+
+// benchHours is 90 days of hourly history.
+const benchHours = 90 * 24
+
+func BenchmarkUpsert(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	layouts := []struct {
+		name string
+		add  func(*Cache, string, models.RateUpdate) error
+	}{
+		{"json-members", addJSONPoint},
+		{"hash-points", (*Cache).AddHistoricalRate},
+	}
+	for _, l := range layouts {
+		b.Run(l.name, func(b *testing.B) {
+			c, _ := newTestCache(b)
+			for h := int64(0); h < benchHours; h++ {
+				if err := l.add(c, "v", benchPoint(h*3600, uint64(h))); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h := int64(i % benchHours)
+				if err := l.add(c, "v", benchPoint(h*3600, uint64(h)+uint64(i))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRangeRead(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	layouts := []struct {
+		name string
+		add  func(*Cache, string, models.RateUpdate) error
+		get  func(*Cache, string, int64, int64) ([]models.RateUpdate, error)
+	}{
+		{"json-members", addJSONPoint, getJSONPoints},
+		{"hash-points", (*Cache).AddHistoricalRate, (*Cache).GetHistoricalRates},
+	}
+	for _, l := range layouts {
+		// Read the last 30 days out of 90
+		b.Run(l.name, func(b *testing.B) {
+			c, _ := newTestCache(b)
+			for h := int64(0); h < benchHours; h++ {
+				if err := l.add(c, "v", benchPoint(h*3600, uint64(h))); err != nil {
+					b.Fatal(err)
+				}
+			}
+			from, to := int64(benchHours-30*24)*3600, int64(benchHours)*3600
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				points, err := l.get(c, "v", from, to)
+				if err != nil || len(points) != 30*24 {
+					b.Fatalf("got %d points, %v", len(points), err)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateHistoryConvertsJSONMembers(t *testing.T) {
+	c, _ := newTestCache(t)
+	// Two JSON points for one hour, as non-atomic writers could leave behind,
+	// plus a point already in the new layout at a later block
+	for _, r := range []models.RateUpdate{benchPoint(0, 5), benchPoint(0, 3), benchPoint(3600, 1), benchPoint(7200, 1)} {
+		b, _ := json.Marshal(r)
+		c.client.ZAdd(context.Background(), historyKey("v"), redis.Z{Score: float64(r.Timestamp), Member: b})
+	}
+	if err := c.AddHistoricalRate("v", benchPoint(7200, 9)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := c.MigrateHistory("v")
+	if err != nil || n != 4 {
+		t.Fatalf("converted %d, %v; want 4", n, err)
+	}
+	if n, err := c.MigrateHistory("v"); err != nil || n != 0 {
+		t.Fatalf("second run converted %d, %v; want 0", n, err)
+	}
+	got, err := c.GetHistoricalRates("v", 0, 7200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := []uint64{5, 1, 9}
+	if len(got) != len(blocks) {
+		t.Fatalf("got %d points, want %d", len(got), len(blocks))
+	}
+	for i, p := range got {
+		if p != benchPoint(p.Timestamp, blocks[i]) {
+			t.Fatalf("point %d = %+v, want block %d", i, p, blocks[i])
+		}
+	}
+}
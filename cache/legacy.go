@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MigrateLegacyKeys moves the keys written before vaults were configurable,
+// latest_rate and rate_history without a vault suffix, to vaultID's keys. A
+// per-vault latest rate already present is newer and wins; history from both is
+// merged. It does nothing once the legacy keys are gone.
+func (c *Cache) MigrateLegacyKeys(vaultID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exists, err := c.client.Exists(ctx, RedisRateKey).Result()
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		renamed, err := c.client.RenameNX(ctx, RedisRateKey, rateKey(vaultID)).Result()
+		if err != nil {
+			return err
+		}
+		if renamed {
+			log.Printf("[MigrateLegacyKeys] Moved %s to %s", RedisRateKey, rateKey(vaultID))
+		} else if err := c.client.Del(ctx, RedisRateKey).Err(); err != nil {
+			return err
+		}
+	}
+	n, err := c.client.ZCard(ctx, RedisHistoryKey).Result()
+	if err != nil || n == 0 {
+		return err
+	}
+	if _, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		// MAX keeps the timestamp score of a member present in both keys; the default SUM would double it
+		pipe.ZUnionStore(ctx, historyKey(vaultID), &redis.ZStore{Keys: []string{historyKey(vaultID), RedisHistoryKey}, Aggregate: "MAX"})
+		pipe.Del(ctx, RedisHistoryKey)
+		return nil
+	}); err != nil {
+		return err
+	}
+	log.Printf("[MigrateLegacyKeys] Merged %d points from %s into %s", n, RedisHistoryKey, historyKey(vaultID))
+	return nil
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Zarathos94/puffer/models"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	c, mr := newTestCache(t)
+	ctx := context.Background()
+	latest, _ := json.Marshal(models.RateUpdate{Timestamp: 7300, Rate: 1.02, BlockNumber: 20})
+	mr.Set(RedisRateKey, string(latest))
+	for _, r := range []models.RateUpdate{
+		{Timestamp: 3600, Rate: 1.01, BlockNumber: 10},
+		{Timestamp: 7200, Rate: 1.02, BlockNumber: 20},
+	} {
+		b, _ := json.Marshal(r)
+		c.client.ZAdd(ctx, RedisHistoryKey, redis.Z{Score: float64(r.Timestamp), Member: b})
+	}
+	if err := c.AddHistoricalRate("pufeth", models.RateUpdate{Timestamp: 10800, Rate: 1.03, BlockNumber: 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.MigrateLegacyKeys("pufeth"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.MigrateHistory("pufeth"); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(RedisRateKey) || mr.Exists(RedisHistoryKey) {
+		t.Fatal("legacy keys left behind")
+	}
+	got, err := c.GetLatestRate("pufeth")
+	if err != nil || got.BlockNumber != 20 {
+		t.Fatalf("latest = %+v, %v", got, err)
+	}
+	history, err := c.GetHistoricalRates("pufeth", 0, 1<<40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].BlockNumber != 10 || history[2].BlockNumber != 30 {
+		t.Fatalf("history = %+v", history)
+	}
+
+	// A second run has nothing to do, and a newer per-vault latest rate is kept.
+	mr.Set(RedisRateKey, string(latest))
+	c.SetLatestRate("pufeth", models.RateUpdate{BlockNumber: 40})
+	if err := c.MigrateLegacyKeys("pufeth"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.GetLatestRate("pufeth"); got.BlockNumber != 40 || mr.Exists(RedisRateKey) {
+		t.Fatalf("latest = %+v", got)
+	}
+}
+
+func TestMigrateLegacyKeysKeepsSharedScores(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx := context.Background()
+	b, _ := json.Marshal(models.RateUpdate{Timestamp: 3600, Rate: 1.01, BlockNumber: 10})
+	for _, key := range []string{RedisHistoryKey, historyKey("pufeth")} {
+		c.client.ZAdd(ctx, key, redis.Z{Score: 3600, Member: b})
+	}
+	if err := c.MigrateLegacyKeys("pufeth"); err != nil {
+		t.Fatal(err)
+	}
+	if score, err := c.client.ZScore(ctx, historyKey("pufeth"), string(b)).Result(); err != nil || score != 3600 {
+		t.Fatalf("score = %v, %v; want the timestamp 3600", score, err)
+	}
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// MemoryStore is a RateStore kept in process memory, for tests and single-instance runs without Redis.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	latest  map[string]models.RateUpdate
+	history map[string]map[int64]models.RateUpdate
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		latest:  make(map[string]models.RateUpdate),
+		history: make(map[string]map[int64]models.RateUpdate),
+	}
+}
+
+func (m *MemoryStore) SetLatestRate(vaultID string, rate models.RateUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latest[vaultID] = rate
+	return nil
+}
+
+func (m *MemoryStore) GetLatestRate(vaultID string) (models.RateUpdate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rate, ok := m.latest[vaultID]
+	if !ok {
+		return models.RateUpdate{}, ErrNotFound
+	}
+	return rate, nil
+}
+
+func (m *MemoryStore) AddHistoricalRate(vaultID string, rate models.RateUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rate.Timestamp = hourStart(rate.Timestamp)
+	points, ok := m.history[vaultID]
+	if !ok {
+		points = make(map[int64]models.RateUpdate)
+		m.history[vaultID] = points
+	}
+	if cur, ok := points[rate.Timestamp]; ok && cur.BlockNumber > rate.BlockNumber {
+		return nil
+	}
+	points[rate.Timestamp] = rate
+	return nil
+}
+
+func (m *MemoryStore) GetHistoricalRates(vaultID string, from, to int64) ([]models.RateUpdate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rates := make([]models.RateUpdate, 0)
+	for ts, rate := range m.history[vaultID] {
+		if ts >= from && ts <= to {
+			rates = append(rates, rate)
+		}
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Timestamp < rates[j].Timestamp })
+	return rates, nil
+}
+
+func (m *MemoryStore) CleanupOldRates(vaultID string, cutoff int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ts := range m.history[vaultID] {
+		if ts < cutoff {
+			delete(m.history[vaultID], ts)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetLastHistoricalTimestamp(vaultID string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var last int64
+	for ts := range m.history[vaultID] {
+		if ts > last {
+			last = ts
+		}
+	}
+	return last, nil
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// sqlMigrations are applied in order and recorded in schema_migrations by their
+// 1-based position. Append new steps; never edit one that has shipped. Every
+// statement must work on both Postgres and SQLite and be safe to rerun.
+var sqlMigrations = [][]string{
+	// 1: latest rates and hourly history. Points are stored as the same JSON the
+	// Redis cache served, with the columns needed to query them alongside.
+	// IF NOT EXISTS adopts tables created before migrations were tracked.
+	{
+		`CREATE TABLE IF NOT EXISTS rate_latest (
+			vault_id   TEXT PRIMARY KEY,
+			data       TEXT NOT NULL,
+			updated_at BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS rate_history (
+			vault_id     TEXT NOT NULL,
+			ts           BIGINT NOT NULL,
+			block_number BIGINT NOT NULL DEFAULT 0,
+			data         TEXT NOT NULL,
+			PRIMARY KEY (vault_id, ts)
+		)`,
+	},
+	// 2: every snapshot with its block metadata.
+	{
+		`CREATE TABLE IF NOT EXISTS rate_updates (
+			vault_id         TEXT NOT NULL,
+			ts               BIGINT NOT NULL,
+			block_number     BIGINT NOT NULL DEFAULT 0,
+			block_hash       TEXT NOT NULL DEFAULT '',
+			block_time       BIGINT NOT NULL DEFAULT 0,
+			rate             DOUBLE PRECISION NOT NULL,
+			rate_decimal     TEXT NOT NULL DEFAULT '',
+			assets_wei       TEXT NOT NULL DEFAULT '',
+			total_supply_wei TEXT NOT NULL DEFAULT '',
+			implementation   TEXT NOT NULL DEFAULT '',
+			status           TEXT NOT NULL DEFAULT '',
+			data             TEXT NOT NULL,
+			PRIMARY KEY (vault_id, ts, block_number)
+		)`,
+		`CREATE INDEX IF NOT EXISTS rate_updates_block ON rate_updates (vault_id, block_number)`,
+	},
+}
+
+// migrationLockID is the Postgres advisory lock key that serializes migrations
+// across replicas starting at the same time.
+const migrationLockID = 0x70756666 // "puff"
+
+// migrateSQL applies the migrations the database hasn't seen yet, all in one
+// transaction. On Postgres the transaction first takes an advisory lock, so a
+// second replica waits and then finds the migrations already recorded.
+func migrateSQL(ctx context.Context, db *sql.DB) error {
+	postgres := isPostgres(ctx, db)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if postgres {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+			return fmt.Errorf("lock migrations: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return err
+	}
+	var current sql.NullInt64
+	if err := tx.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	var applied []int
+	for i := int(current.Int64); i < len(sqlMigrations); i++ {
+		version := i + 1
+		for _, stmt := range sqlMigrations[i] {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("migration %d: %w", version, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`,
+			version, time.Now().Unix()); err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		applied = append(applied, version)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, v := range applied {
+		log.Printf("[SQLStore] Applied schema migration %d", v)
+	}
+	return nil
+}
+
+// isPostgres tells Postgres apart from SQLite, which has no version() function.
+func isPostgres(ctx context.Context, db *sql.DB) bool {
+	var v string
+	return db.QueryRowContext(ctx, `SELECT version()`).Scan(&v) == nil && strings.HasPrefix(v, "PostgreSQL")
+}
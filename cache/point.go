@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// pointVersion is the first byte of every encoded history point.
+const pointVersion = 1
+
+// errBadPoint is returned for history points that can't be decoded.
+var errBadPoint = errors.New("malformed history point")
+
+// encodePoint packs a history point into the compact binary form stored in Redis.
+// The block number sits right after the version byte so the upsert script can
+// read it without decoding the rest.
+func encodePoint(r models.RateUpdate) []byte {
+	b := make([]byte, 0, 128)
+	b = append(b, pointVersion)
+	b = binary.BigEndian.AppendUint64(b, r.BlockNumber)
+	b = binary.BigEndian.AppendUint64(b, uint64(r.Timestamp))
+	b = binary.BigEndian.AppendUint64(b, uint64(r.BlockTime))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(r.Rate))
+	b = binary.BigEndian.AppendUint64(b, math.Float64bits(r.RateDivergenceBps))
+	var flags byte
+	if r.RateMismatch {
+		flags |= 1
+	}
+	b = append(b, flags)
+	for _, s := range []string{
+		r.Assets, r.TotalSupply, r.AssetsWei, r.TotalSupplyWei, r.AssetsPerShare,
+		r.SharesPerAsset, r.RateDecimal, r.BlockHash, r.Implementation, r.Status,
+	} {
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+	return b
+}
+
+// decodePoint unpacks a point written by encodePoint.
+func decodePoint(b []byte) (models.RateUpdate, error) {
+	const fixed = 1 + 5*8 + 1
+	var r models.RateUpdate
+	if len(b) < fixed || b[0] != pointVersion {
+		return r, errBadPoint
+	}
+	r.BlockNumber = binary.BigEndian.Uint64(b[1:])
+	r.Timestamp = int64(binary.BigEndian.Uint64(b[9:]))
+	r.BlockTime = int64(binary.BigEndian.Uint64(b[17:]))
+	r.Rate = math.Float64frombits(binary.BigEndian.Uint64(b[25:]))
+	r.RateDivergenceBps = math.Float64frombits(binary.BigEndian.Uint64(b[33:]))
+	r.RateMismatch = b[41]&1 != 0
+	b = b[fixed:]
+	for _, s := range []*string{
+		&r.Assets, &r.TotalSupply, &r.AssetsWei, &r.TotalSupplyWei, &r.AssetsPerShare,
+		&r.SharesPerAsset, &r.RateDecimal, &r.BlockHash, &r.Implementation, &r.Status,
+	} {
+		n, k := binary.Uvarint(b)
+		if k <= 0 || uint64(len(b)-k) < n {
+			return r, errBadPoint
+		}
+		*s = string(b[k : k+int(n)])
+		b = b[k+int(n):]
+	}
+	return r, nil
+}
@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestPointRoundTrip(t *testing.T) {
+	want := benchPoint(3600, 1<<40)
+	want.RateMismatch = true
+	want.RateDivergenceBps = 1.5
+	got, err := decodePoint(encodePoint(want))
+	if err != nil || got != want {
+		t.Fatalf("got %+v, %v; want %+v", got, err, want)
+	}
+}
+
+func TestDecodePointRejectsTruncated(t *testing.T) {
+	b := encodePoint(benchPoint(3600, 1))
+	for i := 0; i < len(b); i++ {
+		if _, err := decodePoint(b[:i]); err == nil {
+			t.Fatalf("decoded a point truncated to %d of %d bytes", i, len(b))
+		}
+	}
+}
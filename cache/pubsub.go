@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// RedisRateChannel is the pub/sub channel every new RateUpdate is published on.
+const RedisRateChannel = "rate_updates"
+
+// rateMessage is the payload sent on RedisRateChannel.
+type rateMessage struct {
+	VaultID string            `json:"vault_id"`
+	Rate    models.RateUpdate `json:"rate"`
+}
+
+// PublishRate announces a new rate to every replica subscribed to RedisRateChannel.
+func (c *Cache) PublishRate(vaultID string, rate models.RateUpdate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(rateMessage{VaultID: vaultID, Rate: rate})
+	if err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, RedisRateChannel, b).Err()
+}
+
+// SubscribeRates calls fn for every rate published on RedisRateChannel until ctx
+// is done. The client resubscribes on its own after a dropped connection; rates
+// published while it was down are not replayed.
+func (c *Cache) SubscribeRates(ctx context.Context, fn func(vaultID string, rate models.RateUpdate)) {
+	sub := c.client.Subscribe(ctx, RedisRateChannel)
+	defer sub.Close()
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var m rateMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+				log.Printf("[PubSub] Ignoring malformed rate message: %v", err)
+				continue
+			}
+			fn(m.VaultID, m.Rate)
+		}
+	}
+}
+
+// RedisEventChannel is the pub/sub channel vault events such as alerts,
+// upgrades and reorgs are published on, so every replica's SSE clients get them.
+const RedisEventChannel = "vault_events"
+
+// PublishEvent announces a vault event to every replica subscribed to RedisEventChannel.
+func (c *Cache) PublishEvent(e models.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, RedisEventChannel, b).Err()
+}
+
+// SubscribeEvents calls fn for every event published on RedisEventChannel until
+// ctx is done. Event data arrives decoded as generic JSON, not its original type.
+func (c *Cache) SubscribeEvents(ctx context.Context, fn func(e models.Event)) {
+	sub := c.client.Subscribe(ctx, RedisEventChannel)
+	defer sub.Close()
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var e models.Event
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				log.Printf("[PubSub] Ignoring malformed event message: %v", err)
+				continue
+			}
+			fn(e)
+		}
+	}
+}
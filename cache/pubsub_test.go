@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+func TestEventPubSub(t *testing.T) {
+	c, _ := newTestCache(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	got := make(chan models.Event, 1)
+	go c.SubscribeEvents(ctx, func(e models.Event) {
+		select {
+		case got <- e:
+		default:
+		}
+	})
+
+	want := models.Event{Type: models.EventUpgrade, VaultID: "v", Time: 7, Data: map[string]interface{}{"new": "0xb"}}
+	// Publish until the subscription is live; nothing is delivered before that
+	deadline := time.After(2 * time.Second)
+	for {
+		if err := c.PublishEvent(want); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case e := <-got:
+			data, _ := e.Data.(map[string]interface{})
+			if e.Type != want.Type || e.VaultID != want.VaultID || e.Time != want.Time || data["new"] != "0xb" {
+				t.Fatalf("received %+v, want %+v", e, want)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no event received")
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"sort"
 	"strconv"
 	"time"
@@ -16,8 +15,32 @@ import (
 const (
 	RedisRateKey    = "latest_rate"
 	RedisHistoryKey = "rate_history"
+	// RedisPointsKey prefixes the hash of encoded history points, keyed by the
+	// hours indexed under RedisHistoryKey.
+	RedisPointsKey = "rate_points"
+	// RedisBackfillKey prefixes archive backfill checkpoints.
+	RedisBackfillKey = "backfill_progress"
+	// RedisBackfillClaimKey prefixes the lease held by the replica running a vault's backfill.
+	RedisBackfillClaimKey = "backfill_claim"
+	// RedisImplHistoryKey prefixes the sorted set of proxy changes, scored by block.
+	RedisImplHistoryKey = "impl_history"
+	// RedisImplCursorKey prefixes the last block scanned for proxy events.
+	RedisImplCursorKey = "impl_cursor"
+	// RedisAlertsKey prefixes the sorted set of anomaly alerts, scored by timestamp.
+	RedisAlertsKey = "alerts"
+	// maxStoredAlerts is how many alerts are kept per vault.
+	maxStoredAlerts = 1000
+	// RedisGapsKey prefixes the sorted set of hours the hourly snapshot skipped, scored by hour.
+	RedisGapsKey = "history_gaps"
+	// RedisTxPageKey prefixes cached /vault/transactions pages.
+	RedisTxPageKey = "vault_txs"
 )
 
+// rateKey returns the latest-rate key for a vault.
+func rateKey(vaultID string) string {
+	return RedisRateKey + ":" + vaultID
+}
+
 type Cache struct {
 	client *redis.Client
 }
@@ -36,20 +59,23 @@ func NewCache(redisAddr string) (*Cache, error) {
 	return &Cache{client: client}, nil
 }
 
-func (c *Cache) SetLatestRate(rate models.RateUpdate) error {
+func (c *Cache) SetLatestRate(vaultID string, rate models.RateUpdate) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	b, err := json.Marshal(rate)
 	if err != nil {
 		return err
 	}
-	return c.client.Set(ctx, RedisRateKey, b, 0).Err()
+	return c.client.Set(ctx, rateKey(vaultID), b, 0).Err()
 }
 
-func (c *Cache) GetLatestRate() (models.RateUpdate, error) {
+func (c *Cache) GetLatestRate(vaultID string) (models.RateUpdate, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	val, err := c.client.Get(ctx, RedisRateKey).Result()
+	val, err := c.client.Get(ctx, rateKey(vaultID)).Result()
+	if err == redis.Nil {
+		return models.RateUpdate{}, ErrNotFound
+	}
 	if err != nil {
 		return models.RateUpdate{}, err
 	}
@@ -60,72 +86,240 @@ func (c *Cache) GetLatestRate() (models.RateUpdate, error) {
 	return rate, nil
 }
 
-func (c *Cache) AddHistoricalRate(rate models.RateUpdate) error {
+// backfillKey returns the archive backfill checkpoint key for a vault.
+func backfillKey(vaultID string) string {
+	return RedisBackfillKey + ":" + vaultID
+}
+
+func (c *Cache) SaveBackfillProgress(p models.BackfillProgress) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	// Round timestamp to the start of the hour
-	hourTs := rate.Timestamp - (rate.Timestamp % 3600)
-	rate.Timestamp = hourTs
-	b, err := json.Marshal(rate)
+	b, err := json.Marshal(p)
 	if err != nil {
 		return err
 	}
-	// Remove any existing rate for this hour
-	results, err := c.client.ZRangeByScore(ctx, RedisHistoryKey, &redis.ZRangeBy{
-		Min: strconv.FormatInt(hourTs, 10),
-		Max: strconv.FormatInt(hourTs, 10),
-	}).Result()
-	if err == nil && len(results) > 0 {
-		for _, v := range results {
-			_ = c.client.ZRem(ctx, RedisHistoryKey, v).Err()
-		}
+	return c.client.Set(ctx, backfillKey(p.VaultID), b, 0).Err()
+}
+
+// GetBackfillProgress returns the last checkpoint for a vault, or redis.Nil if no job has run.
+func (c *Cache) GetBackfillProgress(vaultID string) (models.BackfillProgress, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	val, err := c.client.Get(ctx, backfillKey(vaultID)).Result()
+	if err != nil {
+		return models.BackfillProgress{}, err
+	}
+	var p models.BackfillProgress
+	if err := json.Unmarshal([]byte(val), &p); err != nil {
+		return models.BackfillProgress{}, err
 	}
-	return c.client.ZAdd(ctx, RedisHistoryKey, redis.Z{
-		Score:  float64(hourTs),
+	return p, nil
+}
+
+// backfillClaimKey returns the backfill lease key for a vault.
+func backfillClaimKey(vaultID string) string {
+	return RedisBackfillClaimKey + ":" + vaultID
+}
+
+// renewClaimScript extends a lease only while ARGV[1] still holds it.
+var renewClaimScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseClaimScript deletes a lease only while ARGV[1] still holds it.
+var releaseClaimScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// ClaimBackfill takes the vault's backfill lease for owner unless another
+// owner holds it. The lease expires after ttl unless renewed.
+func (c *Cache) ClaimBackfill(vaultID, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return c.client.SetNX(ctx, backfillClaimKey(vaultID), owner, ttl).Result()
+}
+
+// RenewBackfillClaim extends owner's lease by ttl. It reports false once the
+// lease has expired or been taken over.
+func (c *Cache) RenewBackfillClaim(vaultID, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	n, err := renewClaimScript.Run(ctx, c.client, []string{backfillClaimKey(vaultID)}, owner, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// ReleaseBackfillClaim gives up owner's lease, if it still holds it.
+func (c *Cache) ReleaseBackfillClaim(vaultID, owner string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return releaseClaimScript.Run(ctx, c.client, []string{backfillClaimKey(vaultID)}, owner).Err()
+}
+
+// AddImplementationChange records a proxy event. Re-indexing the same log is a no-op.
+func (c *Cache) AddImplementationChange(vaultID string, change models.ImplementationChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return c.client.ZAdd(ctx, RedisImplHistoryKey+":"+vaultID, redis.Z{
+		Score:  float64(change.BlockNumber),
 		Member: b,
 	}).Err()
 }
 
-func (c *Cache) GetHistoricalRates(from, to int64) ([]models.RateUpdate, error) {
+// GetImplementationHistory returns every recorded proxy event, oldest first.
+func (c *Cache) GetImplementationHistory(vaultID string) ([]models.ImplementationChange, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	results, err := c.client.ZRangeByScore(ctx, RedisHistoryKey, &redis.ZRangeBy{
-		Min: strconv.FormatInt(from, 10),
-		Max: strconv.FormatInt(to, 10),
+	results, err := c.client.ZRange(ctx, RedisImplHistoryKey+":"+vaultID, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]models.ImplementationChange, 0, len(results))
+	for _, v := range results {
+		var change models.ImplementationChange
+		if err := json.Unmarshal([]byte(v), &change); err == nil {
+			changes = append(changes, change)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].BlockNumber != changes[j].BlockNumber {
+			return changes[i].BlockNumber < changes[j].BlockNumber
+		}
+		return changes[i].LogIndex < changes[j].LogIndex
+	})
+	return changes, nil
+}
+
+func (c *Cache) SetUpgradeCursor(vaultID string, block uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return c.client.Set(ctx, RedisImplCursorKey+":"+vaultID, block, 0).Err()
+}
+
+// GetUpgradeCursor returns the last block scanned for proxy events, or 0 if none has been.
+func (c *Cache) GetUpgradeCursor(vaultID string) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	n, err := c.client.Get(ctx, RedisImplCursorKey+":"+vaultID).Uint64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// AddAlert stores an alert and trims the list to the newest maxStoredAlerts.
+func (c *Cache) AddAlert(alert models.Alert) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	key := RedisAlertsKey + ":" + alert.VaultID
+	pipe := c.client.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(alert.Timestamp), Member: b})
+	pipe.ZRemRangeByRank(ctx, key, 0, -maxStoredAlerts-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetAlerts returns up to limit alerts at or after since, newest first.
+func (c *Cache) GetAlerts(vaultID string, since int64, limit int64) ([]models.Alert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results, err := c.client.ZRevRangeByScore(ctx, RedisAlertsKey+":"+vaultID, &redis.ZRangeBy{
+		Min:   strconv.FormatInt(since, 10),
+		Max:   "+inf",
+		Count: limit,
 	}).Result()
 	if err != nil {
 		return nil, err
 	}
-	ratesMap := make(map[int64]models.RateUpdate)
+	alerts := make([]models.Alert, 0, len(results))
 	for _, v := range results {
-		var rate models.RateUpdate
-		if err := json.Unmarshal([]byte(v), &rate); err == nil {
-			// Only keep one rate per hour (the last one found)
-			ratesMap[rate.Timestamp] = rate
+		var a models.Alert
+		if err := json.Unmarshal([]byte(v), &a); err == nil {
+			alerts = append(alerts, a)
 		}
 	}
-	// Convert map to slice and sort by timestamp ascending
-	rates := make([]models.RateUpdate, 0, len(ratesMap))
-	for _, r := range ratesMap {
-		rates = append(rates, r)
+	return alerts, nil
+}
+
+// AddHistoryGap records a skipped hour, replacing any earlier entry for it.
+func (c *Cache) AddHistoryGap(vaultID string, gap models.HistoryGap) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(gap)
+	if err != nil {
+		return err
 	}
-	sort.Slice(rates, func(i, j int) bool { return rates[i].Timestamp < rates[j].Timestamp })
-	log.Printf("[GetHistoricalRates] Returning %d hourly points from %d to %d", len(rates), from, to)
-	return rates, nil
+	key := RedisGapsKey + ":" + vaultID
+	score := strconv.FormatInt(gap.Hour, 10)
+	pipe := c.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, score, score)
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(gap.Hour), Member: b})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RemoveHistoryGap clears the gap for an hour once it has been recorded.
+func (c *Cache) RemoveHistoryGap(vaultID string, hour int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	score := strconv.FormatInt(hour, 10)
+	return c.client.ZRemRangeByScore(ctx, RedisGapsKey+":"+vaultID, score, score).Err()
 }
 
-func (c *Cache) CleanupOldRates(cutoff int64) error {
+// GetHistoryGaps returns the skipped hours in [from, to], oldest first.
+func (c *Cache) GetHistoryGaps(vaultID string, from, to int64) ([]models.HistoryGap, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	return c.client.ZRemRangeByScore(ctx, RedisHistoryKey, "-inf", fmt.Sprintf("(%d", cutoff)).Err()
+	results, err := c.client.ZRangeByScore(ctx, RedisGapsKey+":"+vaultID, &redis.ZRangeBy{
+		Min: strconv.FormatInt(from, 10),
+		Max: strconv.FormatInt(to, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	gaps := make([]models.HistoryGap, 0, len(results))
+	for _, v := range results {
+		var g models.HistoryGap
+		if err := json.Unmarshal([]byte(v), &g); err == nil {
+			gaps = append(gaps, g)
+		}
+	}
+	return gaps, nil
 }
 
-func (c *Cache) GetLastHistoricalTimestamp() (int64, error) {
+// SetTransactionPage caches a page of vault transactions under a query key for ttl.
+func (c *Cache) SetTransactionPage(vaultID, key string, page models.TransactionPage, ttl time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	res, err := c.client.ZRevRangeWithScores(ctx, RedisHistoryKey, 0, 0).Result()
-	if err != nil || len(res) == 0 {
-		return 0, err
+	b, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, RedisTxPageKey+":"+vaultID+":"+key, b, ttl).Err()
+}
+
+// GetTransactionPage returns a cached page, or redis.Nil when there is none.
+func (c *Cache) GetTransactionPage(vaultID, key string) (models.TransactionPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var page models.TransactionPage
+	val, err := c.client.Get(ctx, RedisTxPageKey+":"+vaultID+":"+key).Result()
+	if err != nil {
+		return page, err
 	}
-	return int64(res[0].Score), nil
+	err = json.Unmarshal([]byte(val), &page)
+	return page, err
 }
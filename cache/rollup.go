@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// RedisRawKey prefixes the sorted set of every snapshot, scored by snapshot time.
+	RedisRawKey = "rate_raw"
+	// RedisRollupKey prefixes the rollup sorted sets, e.g. rate_rollup:5m:pufeth, scored by bucket start.
+	RedisRollupKey = "rate_rollup"
+)
+
+func rawKey(vaultID string) string {
+	return RedisRawKey + ":" + vaultID
+}
+
+func rollupKey(vaultID, resolution string) string {
+	return RedisRollupKey + ":" + resolution + ":" + vaultID
+}
+
+// AddRawRate stores one snapshot in the raw tier, keyed by its own timestamp.
+func (c *Cache) AddRawRate(vaultID string, rate models.RateUpdate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(rate)
+	if err != nil {
+		return err
+	}
+	return c.client.ZAdd(ctx, rawKey(vaultID), redis.Z{Score: float64(rate.Timestamp), Member: b}).Err()
+}
+
+// GetRawRates returns the raw snapshots in [from, to], oldest first.
+func (c *Cache) GetRawRates(vaultID string, from, to int64) ([]models.RateUpdate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results, err := c.client.ZRangeByScore(ctx, rawKey(vaultID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from, 10),
+		Max: strconv.FormatInt(to, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	rates := make([]models.RateUpdate, 0, len(results))
+	for _, v := range results {
+		var rate models.RateUpdate
+		if err := json.Unmarshal([]byte(v), &rate); err == nil {
+			rates = append(rates, rate)
+		}
+	}
+	return rates, nil
+}
+
+// SetRollups writes rollups, replacing any already stored for the same buckets.
+func (c *Cache) SetRollups(vaultID, resolution string, rollups []models.RateRollup) error {
+	if len(rollups) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	key := rollupKey(vaultID, resolution)
+	pipe := c.client.TxPipeline()
+	for _, r := range rollups {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		score := strconv.FormatInt(r.Timestamp, 10)
+		pipe.ZRemRangeByScore(ctx, key, score, score)
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(r.Timestamp), Member: b})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetRollups returns the rollups of one resolution whose buckets start in [from, to], oldest first.
+func (c *Cache) GetRollups(vaultID, resolution string, from, to int64) ([]models.RateRollup, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results, err := c.client.ZRangeByScore(ctx, rollupKey(vaultID, resolution), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from, 10),
+		Max: strconv.FormatInt(to, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	rollups := make([]models.RateRollup, 0, len(results))
+	for _, v := range results {
+		var r models.RateRollup
+		if err := json.Unmarshal([]byte(v), &r); err == nil {
+			rollups = append(rollups, r)
+		}
+	}
+	return rollups, nil
+}
+
+// TrimTier drops entries older than cutoff from the raw tier or a rollup tier.
+func (c *Cache) TrimTier(vaultID, resolution string, cutoff int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	key := rawKey(vaultID)
+	if resolution != models.ResolutionRaw {
+		key = rollupKey(vaultID, resolution)
+	}
+	return c.client.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("(%d", cutoff)).Err()
+}
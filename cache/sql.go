@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// SQLStore is a RateStore on a database/sql connection (Postgres or SQLite).
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore brings the schema up to date (see sqlMigrations).
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := migrateSQL(ctx, db); err != nil {
+		return nil, fmt.Errorf("failed to migrate rate tables: %w", err)
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) SetLatestRate(vaultID string, rate models.RateUpdate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(rate)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO rate_latest (vault_id, data, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (vault_id) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		vaultID, string(b), time.Now().Unix())
+	return err
+}
+
+func (s *SQLStore) GetLatestRate(vaultID string) (models.RateUpdate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM rate_latest WHERE vault_id = $1`, vaultID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.RateUpdate{}, ErrNotFound
+	}
+	if err != nil {
+		return models.RateUpdate{}, err
+	}
+	var rate models.RateUpdate
+	if err := json.Unmarshal([]byte(data), &rate); err != nil {
+		return models.RateUpdate{}, err
+	}
+	return rate, nil
+}
+
+func (s *SQLStore) AddHistoricalRate(vaultID string, rate models.RateUpdate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	rate.Timestamp = hourStart(rate.Timestamp)
+	b, err := json.Marshal(rate)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO rate_history (vault_id, ts, block_number, data) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (vault_id, ts) DO UPDATE SET block_number = excluded.block_number, data = excluded.data
+		WHERE rate_history.block_number <= excluded.block_number`,
+		vaultID, rate.Timestamp, int64(rate.BlockNumber), string(b))
+	return err
+}
+
+func (s *SQLStore) GetHistoricalRates(vaultID string, from, to int64) ([]models.RateUpdate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM rate_history
+		WHERE vault_id = $1 AND ts >= $2 AND ts <= $3 ORDER BY ts`, vaultID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rates := make([]models.RateUpdate, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var rate models.RateUpdate
+		if err := json.Unmarshal([]byte(data), &rate); err == nil {
+			rates = append(rates, rate)
+		}
+	}
+	return rates, rows.Err()
+}
+
+func (s *SQLStore) CleanupOldRates(vaultID string, cutoff int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM rate_history WHERE vault_id = $1 AND ts < $2`, vaultID, cutoff)
+	return err
+}
+
+func (s *SQLStore) GetLastHistoricalTimestamp(vaultID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var last sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT MAX(ts) FROM rate_history WHERE vault_id = $1`, vaultID).Scan(&last)
+	return last.Int64, err
+}
+
+// AddRateUpdate appends one snapshot to rate_updates. Writing the same block
+// again, e.g. once it is confirmed, updates the row.
+func (s *SQLStore) AddRateUpdate(vaultID string, rate models.RateUpdate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(rate)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO rate_updates
+		(vault_id, ts, block_number, block_hash, block_time, rate, rate_decimal, assets_wei, total_supply_wei, implementation, status, data)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (vault_id, ts, block_number) DO UPDATE SET block_hash = excluded.block_hash,
+			block_time = excluded.block_time, rate = excluded.rate, rate_decimal = excluded.rate_decimal,
+			assets_wei = excluded.assets_wei, total_supply_wei = excluded.total_supply_wei,
+			implementation = excluded.implementation, status = excluded.status, data = excluded.data`,
+		vaultID, rate.Timestamp, int64(rate.BlockNumber), rate.BlockHash, rate.BlockTime, rate.Rate, rate.RateDecimal,
+		rate.AssetsWei, rate.TotalSupplyWei, rate.Implementation, rate.Status, string(b))
+	return err
+}
+
+// EnableTimescale turns rate_updates into a TimescaleDB hypertable with weekly
+// chunks. It needs the timescaledb extension to be installable on the server.
+func (s *SQLStore) EnableTimescale() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := s.db.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS timescaledb`); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `SELECT create_hypertable('rate_updates', 'ts',
+		chunk_time_interval => 604800, if_not_exists => TRUE, migrate_data => TRUE)`)
+	return err
+}
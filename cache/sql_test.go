@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// postgresDSNEnv names a Postgres database to run the SQL tests against, e.g.
+// one started with `docker run -e POSTGRES_PASSWORD=pg -p 5432:5432 postgres`
+// and PUFFER_TEST_POSTGRES_DSN=postgres://postgres:pg@localhost/postgres?sslmode=disable.
+// Without it the tests run on SQLite only.
+const postgresDSNEnv = "PUFFER_TEST_POSTGRES_DSN"
+
+// sqlBackend opens fresh, empty databases of one kind.
+type sqlBackend struct {
+	name string
+	open func(t *testing.T) func() *sql.DB
+}
+
+// sqlBackends returns SQLite and, when postgresDSNEnv is set, Postgres. Each
+// call of a backend's open returns a factory for connections to one new database.
+func sqlBackends() []sqlBackend {
+	backends := []sqlBackend{{name: "sqlite", open: openSQLite}}
+	if os.Getenv(postgresDSNEnv) != "" {
+		backends = append(backends, sqlBackend{name: "postgres", open: openPostgres})
+	}
+	return backends
+}
+
+func openSQLite(t *testing.T) func() *sql.DB {
+	path := filepath.Join(t.TempDir(), "rates.db")
+	return func() *sql.DB {
+		db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+}
+
+// openPostgres isolates each test in its own schema, dropped afterwards.
+func openPostgres(t *testing.T) func() *sql.DB {
+	dsn := os.Getenv(postgresDSNEnv)
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("puffer_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		admin.Close()
+	})
+	return func() *sql.DB {
+		db, err := sql.Open("postgres", dsn+"&search_path="+schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+}
+
+func TestSQLMigrations(t *testing.T) {
+	for _, b := range sqlBackends() {
+		t.Run(b.name, func(t *testing.T) {
+			connect := b.open(t)
+			db := connect()
+			// A table from before migrations were tracked is adopted with its rows
+			if _, err := db.Exec(`CREATE TABLE rate_history (vault_id TEXT NOT NULL, ts BIGINT NOT NULL,
+				block_number BIGINT NOT NULL DEFAULT 0, data TEXT NOT NULL, PRIMARY KEY (vault_id, ts))`); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec(`INSERT INTO rate_history VALUES ('v', 3600, 1, '{"timestamp":3600,"block_number":1}')`); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewSQLStore(db); err != nil {
+				t.Fatal(err)
+			}
+			// Replicas starting together all succeed and apply each migration once
+			var wg sync.WaitGroup
+			errs := make(chan error, 8)
+			for i := 0; i < cap(errs); i++ {
+				wg.Add(1)
+				go func(db *sql.DB) {
+					defer wg.Done()
+					_, err := NewSQLStore(db)
+					errs <- err
+				}(connect())
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			var n, max int
+			if err := db.QueryRow(`SELECT COUNT(*), MAX(version) FROM schema_migrations`).Scan(&n, &max); err != nil {
+				t.Fatal(err)
+			}
+			if n != len(sqlMigrations) || max != len(sqlMigrations) {
+				t.Fatalf("schema_migrations has %d rows up to %d, want %d", n, max, len(sqlMigrations))
+			}
+			store, _ := NewSQLStore(db)
+			if ts, err := store.GetLastHistoricalTimestamp("v"); err != nil || ts != 3600 {
+				t.Fatalf("last = %d, %v; want the pre-existing point", ts, err)
+			}
+		})
+	}
+}
+
+func TestSQLStoreRateUpdates(t *testing.T) {
+	for _, b := range sqlBackends() {
+		t.Run(b.name, func(t *testing.T) {
+			db := b.open(t)()
+			store, err := NewSQLStore(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u := models.RateUpdate{Timestamp: 100, Rate: 1.01, BlockNumber: 7, BlockHash: "0xa", Status: models.StatusPending}
+			if err := store.AddRateUpdate("v", u); err != nil {
+				t.Fatal(err)
+			}
+			u.Status = models.StatusConfirmed
+			if err := store.AddRateUpdate("v", u); err != nil {
+				t.Fatal(err)
+			}
+			var n int
+			var status string
+			if err := db.QueryRow(`SELECT COUNT(*), MAX(status) FROM rate_updates WHERE vault_id = 'v'`).Scan(&n, &status); err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 || status != models.StatusConfirmed {
+				t.Fatalf("got %d rows with status %q, want one confirmed row", n, status)
+			}
+		})
+	}
+}
+
+func TestTieredStoreReadsPastHotWindowFromSink(t *testing.T) {
+	for _, b := range sqlBackends() {
+		t.Run(b.name, func(t *testing.T) {
+			sink, err := NewSQLStore(b.open(t)())
+			if err != nil {
+				t.Fatal(err)
+			}
+			hot := NewMemoryStore()
+			window := 48 * time.Hour
+			tiered := NewTieredStore(hot, sink, window)
+			now := time.Now().Unix()
+			now -= now % 3600
+			const hours = 100
+			for h := now - (hours-1)*3600; h <= now; h += 3600 {
+				if err := tiered.AddHistoricalRate("v", models.RateUpdate{Timestamp: h, Rate: float64(h), BlockNumber: uint64(h)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tiered.CleanupOldRates("v", time.Now().Add(-window).Unix()); err != nil {
+				t.Fatal(err)
+			}
+			inHot, _ := hot.GetHistoricalRates("v", 0, now)
+			if len(inHot) >= hours {
+				t.Fatalf("hot store still has %d points", len(inHot))
+			}
+			got, err := tiered.GetHistoricalRates("v", 0, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != hours {
+				t.Fatalf("got %d points, want %d", len(got), hours)
+			}
+			for i, p := range got {
+				if want := now - int64(hours-1-i)*3600; p.Timestamp != want {
+					t.Fatalf("point %d at %d, want %d", i, p.Timestamp, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"errors"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// ErrNotFound is returned by GetLatestRate when a vault has no rate yet.
+var ErrNotFound = errors.New("not found")
+
+// RateStore holds each vault's latest rate and its hourly history. History
+// points are keyed by the start of their hour. Adding a point for an hour that
+// already has one replaces it atomically, unless the stored point was read at
+// a later block.
+type RateStore interface {
+	SetLatestRate(vaultID string, rate models.RateUpdate) error
+	GetLatestRate(vaultID string) (models.RateUpdate, error)
+	AddHistoricalRate(vaultID string, rate models.RateUpdate) error
+	// GetHistoricalRates returns the points in [from, to], oldest first.
+	GetHistoricalRates(vaultID string, from, to int64) ([]models.RateUpdate, error)
+	// CleanupOldRates drops points older than cutoff.
+	CleanupOldRates(vaultID string, cutoff int64) error
+	// GetLastHistoricalTimestamp returns the newest point's timestamp, or 0 when there are none.
+	GetLastHistoricalTimestamp(vaultID string) (int64, error)
+}
+
+var (
+	_ RateStore = (*Cache)(nil)
+	_ RateStore = (*MemoryStore)(nil)
+	_ RateStore = (*SQLStore)(nil)
+)
+
+// hourStart rounds a timestamp down to the start of its hour.
+func hourStart(ts int64) int64 {
+	return ts - (ts % 3600)
+}
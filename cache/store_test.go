@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// storeBackends returns a constructor for every RateStore implementation.
+func storeBackends() map[string]func(t *testing.T) RateStore {
+	backends := map[string]func(t *testing.T) RateStore{
+		"memory": func(t *testing.T) RateStore { return NewMemoryStore() },
+		"redis": func(t *testing.T) RateStore {
+			c, _ := newTestCache(t)
+			return c
+		},
+	}
+	for _, b := range sqlBackends() {
+		open := b.open
+		backends[b.name] = func(t *testing.T) RateStore {
+			store, err := NewSQLStore(open(t)())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		}
+	}
+	return backends
+}
+
+// TestRateStoreConformance checks the RateStore contract against every backend.
+func TestRateStoreConformance(t *testing.T) {
+	for name, open := range storeBackends() {
+		t.Run(name, func(t *testing.T) {
+			t.Run("latest", func(t *testing.T) {
+				s := open(t)
+				if _, err := s.GetLatestRate("v"); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("GetLatestRate on empty store = %v, want ErrNotFound", err)
+				}
+				want := models.RateUpdate{Timestamp: 100, Rate: 1.02, RateDecimal: "1.02", BlockNumber: 9, BlockHash: "0xb"}
+				if err := s.SetLatestRate("v", want); err != nil {
+					t.Fatal(err)
+				}
+				got, err := s.GetLatestRate("v")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Rate != want.Rate || got.RateDecimal != want.RateDecimal || got.BlockNumber != want.BlockNumber || got.BlockHash != want.BlockHash {
+					t.Fatalf("GetLatestRate = %+v, want %+v", got, want)
+				}
+				if _, err := s.GetLatestRate("other"); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("GetLatestRate for another vault = %v, want ErrNotFound", err)
+				}
+			})
+
+			t.Run("empty history", func(t *testing.T) {
+				s := open(t)
+				got, err := s.GetHistoricalRates("v", 0, 1<<40)
+				if err != nil || got == nil || len(got) != 0 {
+					t.Fatalf("GetHistoricalRates = %v, %v; want an empty non-nil slice", got, err)
+				}
+				if last, err := s.GetLastHistoricalTimestamp("v"); err != nil || last != 0 {
+					t.Fatalf("GetLastHistoricalTimestamp = %d, %v; want 0", last, err)
+				}
+			})
+
+			t.Run("upsert", func(t *testing.T) {
+				s := open(t)
+				add := func(ts int64, block uint64, rate float64) {
+					t.Helper()
+					if err := s.AddHistoricalRate("v", models.RateUpdate{Timestamp: ts, BlockNumber: block, Rate: rate}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				add(3600+59, 10, 1.0)  // rounded down to its hour
+				add(3600+120, 12, 1.2) // same hour, later block replaces
+				add(3600+60, 11, 1.1)  // earlier block than stored is ignored
+				add(3600+90, 12, 1.3)  // equal block overwrites
+				got, err := s.GetHistoricalRates("v", 3600, 3600)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != 1 || got[0].Timestamp != 3600 || got[0].BlockNumber != 12 || got[0].Rate != 1.3 {
+					t.Fatalf("hour 3600 = %+v, want one point at block 12 with rate 1.3", got)
+				}
+			})
+
+			t.Run("range", func(t *testing.T) {
+				s := open(t)
+				for _, h := range []int64{5, 1, 3, 2, 4} {
+					if err := s.AddHistoricalRate("v", models.RateUpdate{Timestamp: h * 3600, BlockNumber: uint64(h)}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := s.AddHistoricalRate("other", models.RateUpdate{Timestamp: 3 * 3600, BlockNumber: 99}); err != nil {
+					t.Fatal(err)
+				}
+				got, err := s.GetHistoricalRates("v", 2*3600, 4*3600)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != 3 {
+					t.Fatalf("got %d points in [2h, 4h], want 3", len(got))
+				}
+				for i, p := range got {
+					if want := int64(i+2) * 3600; p.Timestamp != want || p.BlockNumber != uint64(i+2) {
+						t.Fatalf("point %d = %+v, want hour %d from this vault", i, p, want)
+					}
+				}
+				if last, err := s.GetLastHistoricalTimestamp("v"); err != nil || last != 5*3600 {
+					t.Fatalf("GetLastHistoricalTimestamp = %d, %v; want %d", last, err, 5*3600)
+				}
+
+				if err := s.CleanupOldRates("v", 3*3600); err != nil {
+					t.Fatal(err)
+				}
+				got, err = s.GetHistoricalRates("v", 0, 10*3600)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != 3 || got[0].Timestamp != 3*3600 {
+					t.Fatalf("after cleanup got %+v, want hours 3 to 5", got)
+				}
+				if other, _ := s.GetHistoricalRates("other", 0, 10*3600); len(other) != 1 {
+					t.Fatalf("cleanup of one vault touched another: %+v", other)
+				}
+			})
+		})
+	}
+}
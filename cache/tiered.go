@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"log"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// TieredStore serves recent data from a hot store and mirrors every update and
+// hourly point to a SQL sink. Hourly history older than the hot window is read
+// from the sink, so long ranges work after the hot store has pruned them.
+type TieredStore struct {
+	hot    RateStore
+	sink   *SQLStore
+	window time.Duration
+}
+
+var _ RateStore = (*TieredStore)(nil)
+
+// NewTieredStore wraps hot with sink. window is how much history hot keeps;
+// zero means it keeps everything and reads never go to the sink.
+func NewTieredStore(hot RateStore, sink *SQLStore, window time.Duration) *TieredStore {
+	return &TieredStore{hot: hot, sink: sink, window: window}
+}
+
+// SetLatestRate updates the hot store and appends the snapshot to the sink.
+// Sink failures are logged and don't fail the update.
+func (t *TieredStore) SetLatestRate(vaultID string, rate models.RateUpdate) error {
+	if err := t.hot.SetLatestRate(vaultID, rate); err != nil {
+		return err
+	}
+	if err := t.sink.AddRateUpdate(vaultID, rate); err != nil {
+		log.Printf("[Sink] Failed to write update for %s at block %d: %v", vaultID, rate.BlockNumber, err)
+	}
+	return nil
+}
+
+func (t *TieredStore) GetLatestRate(vaultID string) (models.RateUpdate, error) {
+	return t.hot.GetLatestRate(vaultID)
+}
+
+// AddHistoricalRate writes the point to both stores; sink failures are only logged.
+func (t *TieredStore) AddHistoricalRate(vaultID string, rate models.RateUpdate) error {
+	if err := t.hot.AddHistoricalRate(vaultID, rate); err != nil {
+		return err
+	}
+	if err := t.sink.AddHistoricalRate(vaultID, rate); err != nil {
+		log.Printf("[Sink] Failed to write hour %d for %s: %v", hourStart(rate.Timestamp), vaultID, err)
+	}
+	return nil
+}
+
+// GetHistoricalRates reads the part of the range before the hot window from the
+// sink and the rest from the hot store.
+func (t *TieredStore) GetHistoricalRates(vaultID string, from, to int64) ([]models.RateUpdate, error) {
+	if t.window <= 0 {
+		return t.hot.GetHistoricalRates(vaultID, from, to)
+	}
+	edge := hourStart(time.Now().Add(-t.window).Unix()) + 3600
+	if from >= edge {
+		return t.hot.GetHistoricalRates(vaultID, from, to)
+	}
+	rates, err := t.sink.GetHistoricalRates(vaultID, from, min(to, edge-1))
+	if err != nil || to < edge {
+		return rates, err
+	}
+	recent, err := t.hot.GetHistoricalRates(vaultID, edge, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(rates, recent...), nil
+}
+
+// CleanupOldRates prunes the hot store only; the sink keeps everything.
+func (t *TieredStore) CleanupOldRates(vaultID string, cutoff int64) error {
+	return t.hot.CleanupOldRates(vaultID, cutoff)
+}
+
+func (t *TieredStore) GetLastHistoricalTimestamp(vaultID string) (int64, error) {
+	last, err := t.hot.GetLastHistoricalTimestamp(vaultID)
+	if err != nil || last > 0 {
+		return last, err
+	}
+	return t.sink.GetLastHistoricalTimestamp(vaultID)
+}
+
+// SeedSink copies the hot store's history into the sink when the sink has
+// none for the vault yet, so enabling the sink doesn't leave a hole before it.
+func (t *TieredStore) SeedSink(vaultID string) (int, error) {
+	if last, err := t.sink.GetLastHistoricalTimestamp(vaultID); err != nil || last > 0 {
+		return 0, err
+	}
+	points, err := t.hot.GetHistoricalRates(vaultID, 0, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range points {
+		if err := t.sink.AddHistoricalRate(vaultID, p); err != nil {
+			return 0, err
+		}
+	}
+	if len(points) > 0 {
+		log.Printf("[Sink] Seeded %d hourly points for %s", len(points), vaultID)
+	}
+	return len(points), nil
+}
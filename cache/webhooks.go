@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	RedisWebhookSubsKey       = "webhook_subscriptions"
+	RedisWebhookDeliveriesKey = "webhook_deliveries"
+	RedisWebhookDeadKey       = "webhook_dead_letters"
+	// maxDeliveryLog is how many attempts are kept per subscription.
+	maxDeliveryLog = 500
+	// maxDeadLetters is how many dead letters are kept in total.
+	maxDeadLetters = 1000
+)
+
+func (c *Cache) SaveWebhook(sub models.WebhookSubscription) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return c.client.HSet(ctx, RedisWebhookSubsKey, sub.ID, b).Err()
+}
+
+// DeleteWebhook removes a subscription and its delivery log. It reports whether the subscription existed.
+func (c *Cache) DeleteWebhook(id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	n, err := c.client.HDel(ctx, RedisWebhookSubsKey, id).Result()
+	if err != nil {
+		return false, err
+	}
+	c.client.Del(ctx, RedisWebhookDeliveriesKey+":"+id)
+	return n > 0, nil
+}
+
+func (c *Cache) ListWebhooks() ([]models.WebhookSubscription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	res, err := c.client.HGetAll(ctx, RedisWebhookSubsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]models.WebhookSubscription, 0, len(res))
+	for _, v := range res {
+		var sub models.WebhookSubscription
+		if err := json.Unmarshal([]byte(v), &sub); err == nil {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+// LogDelivery prepends an attempt to the subscription's delivery log.
+func (c *Cache) LogDelivery(d models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	key := RedisWebhookDeliveriesKey + ":" + d.SubscriptionID
+	pipe := c.client.TxPipeline()
+	pipe.LPush(ctx, key, b)
+	pipe.LTrim(ctx, key, 0, maxDeliveryLog-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetDeliveries returns up to limit attempts for a subscription, newest first.
+func (c *Cache) GetDeliveries(subID string, limit int64) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	res, err := c.client.LRange(ctx, RedisWebhookDeliveriesKey+":"+subID, 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.WebhookDelivery, 0, len(res))
+	for _, v := range res {
+		var d models.WebhookDelivery
+		if err := json.Unmarshal([]byte(v), &d); err == nil {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (c *Cache) AddDeadLetter(dl models.DeadLetter) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	pipe := c.client.TxPipeline()
+	pipe.LPush(ctx, RedisWebhookDeadKey, b)
+	pipe.LTrim(ctx, RedisWebhookDeadKey, 0, maxDeadLetters-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetDeadLetters returns up to limit dead letters, newest first.
+func (c *Cache) GetDeadLetters(limit int64) ([]models.DeadLetter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	res, err := c.client.LRange(ctx, RedisWebhookDeadKey, 0, limit-1).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	out := make([]models.DeadLetter, 0, len(res))
+	for _, v := range res {
+		var dl models.DeadLetter
+		if err := json.Unmarshal([]byte(v), &dl); err == nil {
+			out = append(out, dl)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,510 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zarathos94/puffer/etherscanclient"
+	"github.com/Zarathos94/puffer/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultChain is the chain used by vaults that do not name one.
+const DefaultChain = "mainnet"
+
+// Chain holds the connection settings for one network.
+type Chain struct {
+	Name string `json:"name"`
+	// ChainID is the EVM chain ID, used by Etherscan's multichain API. Well-known names don't need it.
+	ChainID uint64 `json:"chain_id"`
+	RPCURL  string `json:"rpc_url"`
+	// RPCURLs adds fallback endpoints; all of them form the chain's provider pool.
+	RPCURLs []string `json:"rpc_urls"`
+	WSURL   string   `json:"ws_url"`
+}
+
+// RPCPool tunes routing across a chain's RPC endpoints.
+type RPCPool struct {
+	// HedgeAfter duplicates a call to the next-best endpoint once it is this slow; zero disables hedging.
+	HedgeAfter Duration `json:"hedge_after"`
+	// HealthInterval is how often each endpoint's head is probed.
+	HealthInterval Duration `json:"health_interval"`
+	// AttemptTimeout bounds each endpoint's attempt at a call before failing over.
+	AttemptTimeout Duration `json:"attempt_timeout"`
+}
+
+// Updater modes.
+const (
+	UpdaterPoll   = "poll"
+	UpdaterBlocks = "blocks"
+)
+
+// Updater controls what triggers a snapshot.
+type Updater struct {
+	// Mode is "poll" (fixed interval) or "blocks" (newHeads subscription).
+	Mode string `json:"mode"`
+	// EveryNBlocks snapshots only every Nth block in blocks mode.
+	EveryNBlocks uint64 `json:"every_n_blocks"`
+	// PollInterval is the poll period, also used while the subscription is down.
+	PollInterval Duration `json:"poll_interval"`
+}
+
+// Anomaly sets the rate anomaly detector's thresholds. Zero fields use the
+// detector defaults, except DecreaseBps: only an unset (nil) one does, so an
+// explicit 0 alerts on every drop.
+type Anomaly struct {
+	JumpBps     float64  `json:"jump_bps"`
+	DecreaseBps *float64 `json:"decrease_bps"`
+	ZScore      float64  `json:"z_score"`
+	Window      int      `json:"window"`
+	MinSamples  int      `json:"min_samples"`
+}
+
+// Webhooks tunes webhook delivery and the staleness check that feeds it. Zero fields use the dispatcher defaults.
+type Webhooks struct {
+	// MaxAttempts is how many times a delivery is tried before it is dead-lettered.
+	MaxAttempts int `json:"max_attempts"`
+	// Timeout bounds each delivery attempt.
+	Timeout Duration `json:"timeout"`
+	// StaleAfter is how old the latest snapshot's block may get before a staleness event fires; zero disables the check.
+	StaleAfter Duration `json:"stale_after"`
+}
+
+// Etherscan configures the Etherscan API client. The key comes from ETHERSCAN_API_KEY.
+type Etherscan struct {
+	// BaseURL overrides the API endpoint, e.g. for a proxy.
+	BaseURL string `json:"base_url"`
+	// RateLimit is calls per second; zero uses the free tier's 5.
+	RateLimit float64 `json:"rate_limit"`
+}
+
+// Rollups sets how long each history tier is kept. Zero fields use the defaults
+// (48h raw, 14 days of 5m, 90 days of 1h); daily rollups are kept forever.
+type Rollups struct {
+	RawRetention        Duration `json:"raw_retention"`
+	FiveMinuteRetention Duration `json:"five_minute_retention"`
+	HourlyRetention     Duration `json:"hourly_retention"`
+	// CompactEvery is how often recent rollup buckets are recomputed.
+	CompactEvery Duration `json:"compact_every"`
+}
+
+// Storage backends for rates and history.
+const (
+	StorageRedis    = "redis"
+	StorageMemory   = "memory"
+	StoragePostgres = "postgres"
+)
+
+// Storage picks where latest rates and history are kept. Other state lives in Redis, when it is configured.
+type Storage struct {
+	// Backend is "redis" (default), "memory" or "postgres".
+	Backend string `json:"backend"`
+	// DSN is the database connection string for the postgres backend; STORAGE_DSN overrides it.
+	DSN string `json:"dsn"`
+	// SinkDSN, when set, mirrors every update and hourly point to Postgres for
+	// long-term history; SINK_DSN overrides it.
+	SinkDSN string `json:"sink_dsn"`
+	// Timescale makes the sink's rate_updates table a TimescaleDB hypertable; SINK_TIMESCALE overrides it.
+	Timescale bool `json:"timescale"`
+}
+
+// Config is the vault registry loaded from VAULTS_CONFIG.
+type Config struct {
+	Chains    []Chain        `json:"chains"`
+	Vaults    []models.Vault `json:"vaults"`
+	Updater   Updater        `json:"updater"`
+	RPCPool   RPCPool        `json:"rpc_pool"`
+	Anomaly   Anomaly        `json:"anomaly"`
+	Webhooks  Webhooks       `json:"webhooks"`
+	Etherscan Etherscan      `json:"etherscan"`
+	Storage   Storage        `json:"storage"`
+	Rollups   Rollups        `json:"rollups"`
+	// ConfirmationDepth is how many blocks a snapshot needs on top of it to count as confirmed.
+	ConfirmationDepth uint64 `json:"confirmation_depth"`
+	// HistoryRetention is how long hourly points are kept; zero keeps them forever.
+	HistoryRetention Duration `json:"history_retention"`
+	// BlockResolver picks how timestamps are turned into blocks: "rpc" or "etherscan".
+	BlockResolver string `json:"block_resolver"`
+}
+
+// Block resolver backends.
+const (
+	ResolverRPC       = "rpc"
+	ResolverEtherscan = "etherscan"
+)
+
+// defaultConfirmationDepth matches the usual exchange-grade finality on mainnet.
+const defaultConfirmationDepth = 12
+
+// defaultStaleAfter is a few missed poll intervals on a healthy node.
+const defaultStaleAfter = 10 * time.Minute
+
+// defaultVault is the pufETH vault tracked when no config file is given.
+var defaultVault = models.Vault{
+	ID:      "pufeth",
+	Chain:   DefaultChain,
+	Address: "0xD9A442856C234a39a81a089C06451EBAa4306a72",
+	Label:   "pufETH",
+}
+
+// Load reads the vault registry from the JSON file named by VAULTS_CONFIG.
+// Without a file it falls back to the pufETH vault on mainnet.
+func Load() (*Config, error) {
+	cfg := &Config{
+		ConfirmationDepth: defaultConfirmationDepth,
+		Webhooks:          Webhooks{StaleAfter: Duration(defaultStaleAfter)},
+	}
+	if path := os.Getenv("VAULTS_CONFIG"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault config: %w", err)
+		}
+		if err := json.Unmarshal(b, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse vault config: %w", err)
+		}
+	}
+	if len(cfg.Vaults) == 0 {
+		cfg.Vaults = []models.Vault{defaultVault}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv fills defaults and lets environment variables override the file.
+func (c *Config) applyEnv() error {
+	if v := os.Getenv("UPDATER_MODE"); v != "" {
+		c.Updater.Mode = v
+	}
+	if c.Updater.Mode == "" {
+		c.Updater.Mode = UpdaterPoll
+	}
+	if v := os.Getenv("UPDATE_EVERY_N_BLOCKS"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid UPDATE_EVERY_N_BLOCKS: %w", err)
+		}
+		c.Updater.EveryNBlocks = n
+	}
+	if c.Updater.EveryNBlocks == 0 {
+		c.Updater.EveryNBlocks = 1
+	}
+	if v := os.Getenv("POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid POLL_INTERVAL: %w", err)
+		}
+		c.Updater.PollInterval = Duration(d)
+	}
+	if c.Updater.PollInterval <= 0 {
+		c.Updater.PollInterval = Duration(15 * time.Second)
+	}
+	if v := os.Getenv("RPC_HEDGE_AFTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid RPC_HEDGE_AFTER: %w", err)
+		}
+		c.RPCPool.HedgeAfter = Duration(d)
+	}
+	if v := os.Getenv("RPC_HEALTH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid RPC_HEALTH_INTERVAL: %w", err)
+		}
+		c.RPCPool.HealthInterval = Duration(d)
+	}
+	if v := os.Getenv("RPC_ATTEMPT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid RPC_ATTEMPT_TIMEOUT: %w", err)
+		}
+		c.RPCPool.AttemptTimeout = Duration(d)
+	}
+	if v := os.Getenv("ANOMALY_JUMP_BPS"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ANOMALY_JUMP_BPS: %w", err)
+		}
+		c.Anomaly.JumpBps = f
+	}
+	if v := os.Getenv("ANOMALY_DECREASE_BPS"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ANOMALY_DECREASE_BPS: %w", err)
+		}
+		c.Anomaly.DecreaseBps = &f
+	}
+	if v := os.Getenv("ANOMALY_ZSCORE"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ANOMALY_ZSCORE: %w", err)
+		}
+		c.Anomaly.ZScore = f
+	}
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS: %w", err)
+		}
+		c.Webhooks.MaxAttempts = n
+	}
+	if v := os.Getenv("WEBHOOK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid WEBHOOK_TIMEOUT: %w", err)
+		}
+		c.Webhooks.Timeout = Duration(d)
+	}
+	if v := os.Getenv("STALE_AFTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid STALE_AFTER: %w", err)
+		}
+		c.Webhooks.StaleAfter = Duration(d)
+	}
+	if v := os.Getenv("HISTORY_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid HISTORY_RETENTION: %w", err)
+		}
+		c.HistoryRetention = Duration(d)
+	}
+	if v := os.Getenv("ETHERSCAN_API_URL"); v != "" {
+		c.Etherscan.BaseURL = v
+	}
+	if v := os.Getenv("ETHERSCAN_RATE_LIMIT"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ETHERSCAN_RATE_LIMIT: %w", err)
+		}
+		c.Etherscan.RateLimit = f
+	}
+	for env, dst := range map[string]*Duration{
+		"RAW_RETENTION":        &c.Rollups.RawRetention,
+		"ROLLUP_5M_RETENTION":  &c.Rollups.FiveMinuteRetention,
+		"ROLLUP_1H_RETENTION":  &c.Rollups.HourlyRetention,
+		"ROLLUP_COMPACT_EVERY": &c.Rollups.CompactEvery,
+	} {
+		if v := os.Getenv(env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", env, err)
+			}
+			*dst = Duration(d)
+		}
+	}
+	if v := os.Getenv("STORAGE_BACKEND"); v != "" {
+		c.Storage.Backend = v
+	}
+	if c.Storage.Backend == "" {
+		c.Storage.Backend = StorageRedis
+	}
+	if v := os.Getenv("STORAGE_DSN"); v != "" {
+		c.Storage.DSN = v
+	}
+	if v := os.Getenv("SINK_DSN"); v != "" {
+		c.Storage.SinkDSN = v
+	}
+	if v := os.Getenv("SINK_TIMESCALE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid SINK_TIMESCALE: %w", err)
+		}
+		c.Storage.Timescale = b
+	}
+	if v := os.Getenv("BLOCK_RESOLVER"); v != "" {
+		c.BlockResolver = v
+	}
+	if c.BlockResolver == "" {
+		c.BlockResolver = ResolverRPC
+	}
+	if v := os.Getenv("CONFIRMATION_DEPTH"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid CONFIRMATION_DEPTH: %w", err)
+		}
+		c.ConfirmationDepth = n
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	if c.Updater.Mode != UpdaterPoll && c.Updater.Mode != UpdaterBlocks {
+		return fmt.Errorf("unknown updater mode %q", c.Updater.Mode)
+	}
+	if c.BlockResolver != ResolverRPC && c.BlockResolver != ResolverEtherscan {
+		return fmt.Errorf("unknown block resolver %q", c.BlockResolver)
+	}
+	switch c.Storage.Backend {
+	case StorageRedis, StorageMemory:
+	case StoragePostgres:
+		if c.Storage.DSN == "" {
+			return fmt.Errorf("postgres storage needs STORAGE_DSN")
+		}
+	default:
+		return fmt.Errorf("unknown storage backend %q", c.Storage.Backend)
+	}
+	if c.Storage.SinkDSN != "" && c.Storage.Backend == StoragePostgres {
+		return fmt.Errorf("SINK_DSN is redundant with postgres storage")
+	}
+	seen := make(map[string]bool)
+	for i := range c.Vaults {
+		v := &c.Vaults[i]
+		if v.ID == "" {
+			return fmt.Errorf("vault %d has no id", i)
+		}
+		if seen[v.ID] {
+			return fmt.Errorf("duplicate vault id %q", v.ID)
+		}
+		seen[v.ID] = true
+		if !common.IsHexAddress(v.Address) {
+			return fmt.Errorf("vault %q has invalid address %q", v.ID, v.Address)
+		}
+		if v.Chain == "" {
+			v.Chain = DefaultChain
+		}
+		if v.Label == "" {
+			v.Label = v.ID
+		}
+		if len(c.RPCURLs(v.Chain)) == 0 {
+			return fmt.Errorf("no RPC URL configured for chain %q (vault %q)", v.Chain, v.ID)
+		}
+		if _, ok := c.ChainID(v.Chain); !ok && c.BlockResolver == ResolverEtherscan {
+			return fmt.Errorf("etherscan block resolver needs a chain_id for chain %q (vault %q)", v.Chain, v.ID)
+		}
+		if c.Updater.Mode == UpdaterBlocks && c.WSURL(v.Chain) == "" {
+			return fmt.Errorf("blocks updater needs a WebSocket URL for chain %q (vault %q)", v.Chain, v.ID)
+		}
+	}
+	return nil
+}
+
+// RPCURLs returns the RPC endpoints for a chain. URLs in the config file win,
+// then ETH_RPC_URL_<CHAIN>, and mainnet finally falls back to ETH_RPC_URL.
+// Environment variables may list several comma-separated URLs.
+func (c *Config) RPCURLs(chain string) []string {
+	for _, ch := range c.Chains {
+		if ch.Name != chain {
+			continue
+		}
+		var urls []string
+		if ch.RPCURL != "" {
+			urls = append(urls, ch.RPCURL)
+		}
+		urls = append(urls, ch.RPCURLs...)
+		if len(urls) > 0 {
+			return urls
+		}
+	}
+	if v := os.Getenv("ETH_RPC_URL_" + envName(chain)); v != "" {
+		return splitList(v)
+	}
+	if chain == DefaultChain {
+		return splitList(os.Getenv("ETH_RPC_URL"))
+	}
+	return nil
+}
+
+// ChainNames lists every chain used by a configured vault, in config order.
+func (c *Config) ChainNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, v := range c.Vaults {
+		if !seen[v.Chain] {
+			seen[v.Chain] = true
+			names = append(names, v.Chain)
+		}
+	}
+	return names
+}
+
+// WSURL returns the WebSocket endpoint for a chain, resolved like RPCURL
+// through ETH_WS_URL_<CHAIN> and ETH_WS_URL.
+func (c *Config) WSURL(chain string) string {
+	for _, ch := range c.Chains {
+		if ch.Name == chain && ch.WSURL != "" {
+			return ch.WSURL
+		}
+	}
+	if url := os.Getenv("ETH_WS_URL_" + envName(chain)); url != "" {
+		return url
+	}
+	if chain == DefaultChain {
+		return os.Getenv("ETH_WS_URL")
+	}
+	return ""
+}
+
+// ChainID returns the configured chain ID, falling back to the well-known ID for the chain's name.
+func (c *Config) ChainID(chain string) (uint64, bool) {
+	for _, ch := range c.Chains {
+		if ch.Name == chain && ch.ChainID != 0 {
+			return ch.ChainID, true
+		}
+	}
+	return etherscanclient.ChainIDByName(chain)
+}
+
+// Vault looks up a vault by ID.
+func (c *Config) Vault(id string) (models.Vault, bool) {
+	for _, v := range c.Vaults {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return models.Vault{}, false
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func envName(s string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", " ", "_").Replace(s))
+}
+
+// Duration is a time.Duration that reads from JSON strings such as "15s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LegacyVaultID returns the configured vault that tracks the pufETH vault the
+// service followed before vaults were configurable, whose data sits under the
+// unsuffixed Redis keys.
+func (c *Config) LegacyVaultID() (string, bool) {
+	for _, v := range c.Vaults {
+		if v.Chain == defaultVault.Chain && strings.EqualFold(v.Address, defaultVault.Address) {
+			return v.ID, true
+		}
+	}
+	return "", false
+}
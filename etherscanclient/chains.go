@@ -0,0 +1,26 @@
+package etherscanclient
+
+import "strings"
+
+// Well-known chain IDs for the V2 API's chainid parameter.
+var chainIDs = map[string]uint64{
+	"mainnet":  1,
+	"ethereum": 1,
+	"sepolia":  11155111,
+	"holesky":  17000,
+	"hoodi":    560048,
+	"arbitrum": 42161,
+	"optimism": 10,
+	"base":     8453,
+	"polygon":  137,
+	"bsc":      56,
+	"linea":    59144,
+	"scroll":   534352,
+	"zksync":   324,
+}
+
+// ChainIDByName returns the chain ID for a well-known chain name such as "holesky" or "base".
+func ChainIDByName(name string) (uint64, bool) {
+	id, ok := chainIDs[strings.ToLower(name)]
+	return id, ok
+}
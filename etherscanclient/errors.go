@@ -0,0 +1,125 @@
+package etherscanclient
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	// ErrRateLimited means Etherscan rejected the call for exceeding the key's rate limit.
+	ErrRateLimited = errors.New("etherscan: rate limit reached")
+	// ErrInvalidKey means the API key is missing or not accepted.
+	ErrInvalidKey = errors.New("etherscan: invalid API key")
+	// ErrNoResults means the query matched nothing, e.g. an address with no transactions.
+	ErrNoResults = errors.New("etherscan: no results")
+	// ErrInvalidResult means an eth_call result was not a whole number of 32-byte hex words.
+	ErrInvalidResult = errors.New("etherscan: invalid eth_call result")
+)
+
+// APIError is a failure reported in an Etherscan response body.
+type APIError struct {
+	Module  string
+	Action  string
+	Message string
+	Result  string
+	kind    error
+}
+
+func (e *APIError) Error() string {
+	if e.Result != "" && e.Result != e.Message {
+		return fmt.Sprintf("etherscan %s/%s: %s (%s)", e.Module, e.Action, e.Message, e.Result)
+	}
+	return fmt.Sprintf("etherscan %s/%s: %s", e.Module, e.Action, e.Message)
+}
+
+// Unwrap lets errors.Is match ErrRateLimited, ErrInvalidKey and ErrNoResults.
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// classify maps Etherscan's free-form messages onto the sentinel errors.
+func classify(message, result string) error {
+	text := strings.ToLower(message + " " + result)
+	switch {
+	case strings.Contains(text, "rate limit"):
+		return ErrRateLimited
+	case strings.Contains(text, "invalid api key"), strings.Contains(text, "missing/invalid api key"):
+		return ErrInvalidKey
+	case strings.Contains(text, "no transactions found"), strings.Contains(text, "no records found"):
+		return ErrNoResults
+	}
+	return nil
+}
+
+// RPCError is a JSON-RPC error object returned by the proxy module, e.g. a reverted eth_call.
+type RPCError struct {
+	Module  string
+	Action  string
+	Code    int
+	Message string
+	// Data is the hex revert data, if the node returned any.
+	Data string
+}
+
+func (e *RPCError) Error() string {
+	msg := fmt.Sprintf("etherscan %s/%s: rpc error %d: %s", e.Module, e.Action, e.Code, e.Message)
+	if reason, ok := e.RevertReason(); ok {
+		msg += fmt.Sprintf(" (reason: %q)", reason)
+	} else if e.Data != "" {
+		msg += " (data: " + e.Data + ")"
+	}
+	return msg
+}
+
+// Reverted reports whether the call reverted rather than failed in the node.
+func (e *RPCError) Reverted() bool {
+	return e.Code == 3 || strings.Contains(strings.ToLower(e.Message), "execution reverted")
+}
+
+// RevertData returns the raw revert bytes, or nil when there are none.
+func (e *RPCError) RevertData() []byte {
+	b, err := hexutil.Decode(e.Data)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// RevertReason decodes an Error(string) revert. It returns false for custom errors and empty data.
+func (e *RPCError) RevertReason() (string, bool) {
+	reason, err := abi.UnpackRevert(e.RevertData())
+	if err != nil {
+		return "", false
+	}
+	return reason, true
+}
+
+// validateWords checks that result is 0x-prefixed hex holding one or more 32-byte words.
+func validateWords(result string) ([]byte, error) {
+	if !strings.HasPrefix(result, "0x") {
+		return nil, fmt.Errorf("%w: %q is not 0x-prefixed hex", ErrInvalidResult, truncate(result))
+	}
+	b, err := hexutil.Decode(result)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrInvalidResult, truncate(result), err)
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%w: empty result (no contract code at this block?)", ErrInvalidResult)
+	}
+	if len(b)%common.HashLength != 0 {
+		return nil, fmt.Errorf("%w: %d bytes is not a whole number of 32-byte words", ErrInvalidResult, len(b))
+	}
+	return b, nil
+}
+
+func truncate(s string) string {
+	if len(s) > 80 {
+		return s[:80] + "..."
+	}
+	return s
+}
@@ -1,61 +1,286 @@
 package etherscanclient
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func getEtherscanAPIKey() string {
-	return os.Getenv("ETHERSCAN_API_KEY")
+const (
+	// DefaultBaseURL is the V2 multichain endpoint; every call carries a chainid.
+	DefaultBaseURL = "https://api.etherscan.io/v2/api"
+	// MainnetChainID is used when Options.ChainID is unset.
+	MainnetChainID = 1
+	// DefaultRateLimit is the free tier's calls per second.
+	DefaultRateLimit = 5
+	defaultRetries   = 3
+	defaultBackoff   = 500 * time.Millisecond
+	defaultTimeout   = 15 * time.Second
+)
+
+// Options configures a Client. Zero fields use the defaults.
+type Options struct {
+	BaseURL string
+	// ChainID selects the chain on the V2 endpoint; zero means mainnet.
+	ChainID    uint64
+	APIKey     string
+	HTTPClient *http.Client
+	// RateLimit is the number of calls per second shared by all callers of the Client.
+	RateLimit float64
+	// MaxRetries is how many times a rate-limited or failed call is retried.
+	MaxRetries int
+	// Backoff is the delay before the first retry; it doubles on each retry.
+	Backoff time.Duration
+}
+
+// Client talks to the Etherscan API for one chain.
+type Client struct {
+	baseURL string
+	chainID uint64
+	apiKey  string
+	http    *http.Client
+	limiter *limiter
+	retries int
+	backoff time.Duration
+}
+
+func NewClient(opts Options) *Client {
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultBaseURL
+	}
+	if opts.ChainID == 0 {
+		opts.ChainID = MainnetChainID
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: defaultTimeout}
+	}
+	if opts.RateLimit <= 0 {
+		opts.RateLimit = DefaultRateLimit
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = defaultRetries
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultBackoff
+	}
+	return &Client{
+		baseURL: opts.BaseURL,
+		chainID: opts.ChainID,
+		apiKey:  opts.APIKey,
+		http:    opts.HTTPClient,
+		limiter: newLimiter(opts.RateLimit, int(opts.RateLimit)),
+		retries: opts.MaxRetries,
+		backoff: opts.Backoff,
+	}
+}
+
+// ForChain returns a client for another chain. It shares the API key, HTTP
+// client and rate limiter, since Etherscan limits a key across all chains.
+func (c *Client) ForChain(chainID uint64) *Client {
+	cc := *c
+	cc.chainID = chainID
+	return &cc
+}
+
+// ChainID returns the chain this client queries.
+func (c *Client) ChainID() uint64 {
+	return c.chainID
 }
 
-func GetBlockNumberByTimestamp(ts int64) (string, error) {
-	apiKey := getEtherscanAPIKey()
-	url := fmt.Sprintf(
-		"https://api.etherscan.io/api?module=block&action=getblocknobytime&timestamp=%d&closest=before&apikey=%s",
-		ts, apiKey,
-	)
-	resp, err := http.Get(url)
+// response covers both the REST envelope and the JSON-RPC one used by the proxy module.
+type response struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+	Error   *struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	} `json:"error"`
+}
+
+// get calls module/action with params and returns the raw result, retrying
+// rate limits, HTTP 429/5xx and network failures with exponential backoff.
+func (c *Client) get(ctx context.Context, module, action string, params url.Values) (json.RawMessage, error) {
+	q := url.Values{}
+	for k, v := range params {
+		q[k] = v
+	}
+	q.Set("chainid", strconv.FormatUint(c.chainID, 10))
+	q.Set("module", module)
+	q.Set("action", action)
+	if c.apiKey != "" {
+		q.Set("apikey", c.apiKey)
+	}
+	endpoint := c.baseURL + "?" + q.Encode()
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var result json.RawMessage
+		result, err = c.do(ctx, module, action, endpoint)
+		if err == nil || !retryable(err) || attempt >= c.retries {
+			return result, err
+		}
+		delay := c.backoff << attempt
+		log.Printf("[Etherscan] %s/%s failed, retrying in %s: %v", module, action, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, module, action, endpoint string) (json.RawMessage, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, redact(err)
 	}
 	defer resp.Body.Close()
-	var result struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-		Result  string `json:"result"`
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &APIError{Module: module, Action: action, Message: resp.Status, kind: ErrRateLimited}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, &httpError{status: resp.StatusCode, text: resp.Status}
+	}
+	var r response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("etherscan %s/%s: decode response: %w", module, action, err)
 	}
-	if result.Status != "1" {
-		return "", fmt.Errorf("etherscan error: %s", result.Message)
+	if r.Error != nil {
+		if kind := classify(r.Error.Message, ""); kind != nil {
+			return nil, &APIError{Module: module, Action: action, Message: r.Error.Message, kind: kind}
+		}
+		rpcErr := &RPCError{Module: module, Action: action, Code: r.Error.Code, Message: r.Error.Message}
+		// Nodes return revert data either as a hex string or nested in an object
+		var data string
+		if json.Unmarshal(r.Error.Data, &data) == nil {
+			rpcErr.Data = data
+		} else {
+			var nested struct {
+				Data string `json:"data"`
+			}
+			if json.Unmarshal(r.Error.Data, &nested) == nil {
+				rpcErr.Data = nested.Data
+			}
+		}
+		return nil, rpcErr
 	}
-	return result.Result, nil
+	if r.Status == "0" {
+		var text string
+		_ = json.Unmarshal(r.Result, &text)
+		return nil, &APIError{Module: module, Action: action, Message: r.Message, Result: text, kind: classify(r.Message, text)}
+	}
+	// The proxy module reports some failures, rate limits included, as a bare string result
+	if module == "proxy" && r.Status == "" {
+		var text string
+		if json.Unmarshal(r.Result, &text) == nil {
+			if kind := classify("", text); kind != nil {
+				return nil, &APIError{Module: module, Action: action, Message: text, kind: kind}
+			}
+		}
+	}
+	return r.Result, nil
+}
+
+// redact drops the query, which holds the API key, from the URL a transport
+// error quotes. The cause is kept, so errors.Is still sees context errors.
+func redact(err error) error {
+	var uErr *url.Error
+	if !errors.As(err, &uErr) {
+		return err
+	}
+	u := uErr.URL
+	if i := strings.IndexByte(u, '?'); i >= 0 {
+		u = u[:i]
+	}
+	return &url.Error{Op: uErr.Op, URL: u, Err: uErr.Err}
+}
+
+type httpError struct {
+	status int
+	text   string
+}
+
+func (e *httpError) Error() string {
+	return "etherscan: unexpected HTTP status " + e.text
+}
+
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return false
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return false
+	}
+	var hErr *httpError
+	if errors.As(err, &hErr) {
+		return hErr.status >= 500
+	}
+	// Transport failures and truncated bodies
+	return true
 }
 
-func CallContractAtBlock(contract, data, block string) (string, error) {
-	apiKey := getEtherscanAPIKey()
-	url := fmt.Sprintf(
-		"https://api.etherscan.io/api?module=proxy&action=eth_call&to=%s&data=%s&tag=%s&apikey=%s",
-		contract, data, block, apiKey,
-	)
-	resp, err := http.Get(url)
+// GetBlockNumberByTimestamp returns the last block mined at or before ts.
+func (c *Client) GetBlockNumberByTimestamp(ctx context.Context, ts int64) (uint64, error) {
+	res, err := c.get(ctx, "block", "getblocknobytime", url.Values{
+		"timestamp": {strconv.FormatInt(ts, 10)},
+		"closest":   {"before"},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var s string
+	if err := json.Unmarshal(res, &s); err != nil {
+		return 0, fmt.Errorf("etherscan block/getblocknobytime: unexpected result %s", res)
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// CallContractAtBlock runs eth_call with calldata against contract at block
+// (a hex block number or tag) and returns the hex result. Reverts come back as
+// *RPCError and results that aren't whole 32-byte words as ErrInvalidResult.
+func (c *Client) CallContractAtBlock(ctx context.Context, contract, data, block string) (string, error) {
+	res, err := c.get(ctx, "proxy", "eth_call", url.Values{
+		"to":   {contract},
+		"data": {data},
+		"tag":  {block},
+	})
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-	var result struct {
-		Jsonrpc string `json:"jsonrpc"`
-		ID      int    `json:"id"`
-		Result  string `json:"result"`
+	var s string
+	if err := json.Unmarshal(res, &s); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidResult, res)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if _, err := validateWords(s); err != nil {
 		return "", err
 	}
-	return result.Result, nil
+	return s, nil
 }
 
 // Transaction represents a single transaction returned by Etherscan
@@ -82,42 +307,26 @@ type Transaction struct {
 	Confirmations     string `json:"confirmations"`
 }
 
-// GetTransactionsByAddress fetches a list of transactions for a given address from Etherscan
-func GetTransactionsByAddress(address string, startBlock, endBlock, page, offset int, sort string) ([]Transaction, error) {
-	apiKey := getEtherscanAPIKey()
-	url := fmt.Sprintf(
-		"https://api.etherscan.io/api?module=account&action=txlist&address=%s&startblock=%d&endblock=%d&page=%d&offset=%d&sort=%s&apikey=%s",
-		address, startBlock, endBlock, page, offset, sort, apiKey,
-	)
-	resp, err := http.Get(url)
+// GetTransactionsByAddress fetches a list of transactions for a given address from Etherscan.
+// It returns ErrNoResults when the address has none in the range.
+func (c *Client) GetTransactionsByAddress(ctx context.Context, address string, startBlock, endBlock, page, offset int, sort string) ([]Transaction, error) {
+	res, err := c.get(ctx, "account", "txlist", url.Values{
+		"address":    {address},
+		"startblock": {strconv.Itoa(startBlock)},
+		"endblock":   {strconv.Itoa(endBlock)},
+		"page":       {strconv.Itoa(page)},
+		"offset":     {strconv.Itoa(offset)},
+		"sort":       {sort},
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	var raw struct {
-		Status  string          `json:"status"`
-		Message string          `json:"message"`
-		Result  json.RawMessage `json:"result"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
-		return nil, err
-	}
-	if raw.Status != "1" {
-		// Try to extract the result as a string for more info
-		var resultMsg string
-		_ = json.Unmarshal(raw.Result, &resultMsg)
-		return nil, fmt.Errorf("etherscan error: %s (%s)", raw.Message, resultMsg)
-	}
-
 	var txs []Transaction
-	if err := json.Unmarshal(raw.Result, &txs); err == nil {
-		return txs, nil
+	if err := json.Unmarshal(res, &txs); err != nil {
+		return nil, fmt.Errorf("etherscan account/txlist: unexpected result format: %w", err)
 	}
-	// If not an array, check if it's a string (e.g., "No transactions found")
-	var s string
-	if err := json.Unmarshal(raw.Result, &s); err == nil {
-		return []Transaction{}, nil
+	if len(txs) == 0 {
+		return nil, &APIError{Module: "account", Action: "txlist", Message: "No transactions found", kind: ErrNoResults}
 	}
-	return nil, fmt.Errorf("unexpected result format from etherscan")
+	return txs, nil
 }
@@ -0,0 +1,179 @@
+package etherscanclient
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for srv's /v2/api without rate limiting or
+// noticeable backoff.
+func newTestClient(srv *httptest.Server) *Client {
+	return NewClient(Options{
+		BaseURL:   srv.URL + "/v2/api",
+		APIKey:    "key",
+		RateLimit: 1000,
+		Backoff:   time.Millisecond,
+	})
+}
+
+func TestClientBuildsV2Requests(t *testing.T) {
+	var chainIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/v2/api" {
+			t.Errorf("path = %q, want /v2/api", r.URL.Path)
+		}
+		want := map[string]string{"module": "block", "action": "getblocknobytime", "timestamp": "1700000000", "closest": "before", "apikey": "key"}
+		for k, v := range want {
+			if q.Get(k) != v {
+				t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+			}
+		}
+		chainIDs = append(chainIDs, q.Get("chainid"))
+		fmt.Fprint(w, `{"status":"1","message":"OK","result":"18500000"}`)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv)
+	for _, client := range []*Client{c, c.ForChain(17000)} {
+		block, err := client.GetBlockNumberByTimestamp(context.Background(), 1700000000)
+		if err != nil || block != 18500000 {
+			t.Fatalf("GetBlockNumberByTimestamp = %d, %v", block, err)
+		}
+	}
+	if strings.Join(chainIDs, ",") != "1,17000" {
+		t.Fatalf("chainid params = %v, want mainnet by default and 17000 from ForChain", chainIDs)
+	}
+}
+
+// revertData encodes Error(reason) as a node returns it.
+func revertData(reason string) string {
+	padded := make([]byte, (len(reason)+31)/32*32)
+	copy(padded, reason)
+	return fmt.Sprintf("0x08c379a0%064x%064x%s", 32, len(reason), hex.EncodeToString(padded))
+}
+
+func TestClientMapsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		check  func(t *testing.T, err error)
+	}{
+		{"rate limit", 200, `{"status":"0","message":"NOTOK","result":"Max rate limit reached"}`, func(t *testing.T, err error) {
+			if !errors.Is(err, ErrRateLimited) {
+				t.Fatalf("err = %v, want ErrRateLimited", err)
+			}
+		}},
+		{"http 429", 429, ``, func(t *testing.T, err error) {
+			if !errors.Is(err, ErrRateLimited) {
+				t.Fatalf("err = %v, want ErrRateLimited", err)
+			}
+		}},
+		{"invalid key", 200, `{"status":"0","message":"NOTOK","result":"Invalid API Key"}`, func(t *testing.T, err error) {
+			if !errors.Is(err, ErrInvalidKey) {
+				t.Fatalf("err = %v, want ErrInvalidKey", err)
+			}
+		}},
+		{"proxy rate limit", 200, `{"jsonrpc":"2.0","id":1,"result":"Max rate limit reached, please use API Key for higher rate limit"}`, func(t *testing.T, err error) {
+			if !errors.Is(err, ErrRateLimited) {
+				t.Fatalf("err = %v, want ErrRateLimited", err)
+			}
+		}},
+		{"revert", 200, `{"jsonrpc":"2.0","id":1,"error":{"code":3,"message":"execution reverted: paused","data":"` + revertData("paused") + `"}}`, func(t *testing.T, err error) {
+			var rpcErr *RPCError
+			if !errors.As(err, &rpcErr) || !rpcErr.Reverted() {
+				t.Fatalf("err = %v, want a reverted *RPCError", err)
+			}
+			if reason, ok := rpcErr.RevertReason(); !ok || reason != "paused" {
+				t.Fatalf("RevertReason = %q, %v", reason, ok)
+			}
+		}},
+		{"empty result", 200, `{"jsonrpc":"2.0","id":1,"result":"0x"}`, func(t *testing.T, err error) {
+			if !errors.Is(err, ErrInvalidResult) {
+				t.Fatalf("err = %v, want ErrInvalidResult", err)
+			}
+		}},
+		{"server error", 502, ``, func(t *testing.T, err error) {
+			var hErr *httpError
+			if !errors.As(err, &hErr) || hErr.status != 502 {
+				t.Fatalf("err = %v, want HTTP 502", err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+			_, err := newTestClient(srv).CallContractAtBlock(context.Background(), "0xabc", "0x01", "latest")
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int32
+		status    int
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"recovers from 5xx", 2, 503, 3, false},
+		{"recovers from 429", 1, 429, 2, false},
+		{"gives up after MaxRetries", 100, 500, 4, true},
+		{"does not retry 4xx", 100, 404, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					w.WriteHeader(tt.status)
+					return
+				}
+				fmt.Fprint(w, `{"status":"1","message":"OK","result":"7"}`)
+			}))
+			defer srv.Close()
+			_, err := newTestClient(srv).GetBlockNumberByTimestamp(context.Background(), 1)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Fatalf("made %d requests, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClientErrorsOmitAPIKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	addr := srv.URL
+	srv.Close() // refuse connections
+	c := NewClient(Options{BaseURL: addr + "/v2/api", APIKey: "SECRETKEY123", RateLimit: 1000, Backoff: time.Millisecond})
+	_, err := c.GetBlockNumberByTimestamp(context.Background(), 1)
+	if err == nil {
+		t.Fatal("call to a closed server succeeded")
+	}
+	if strings.Contains(err.Error(), "SECRETKEY123") {
+		t.Fatalf("error leaks the API key: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.GetBlockNumberByTimestamp(ctx, 1)
+	if !errors.Is(err, context.Canceled) || strings.Contains(err.Error(), "SECRETKEY123") {
+		t.Fatalf("canceled call = %v, want context.Canceled without the key", err)
+	}
+}
@@ -0,0 +1,109 @@
+package etherscanclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strconv"
+)
+
+const (
+	// resultWindow is the most records Etherscan returns for one query: page*offset must not exceed it.
+	resultWindow = 10000
+	// DefaultPageSize is the offset used by Transactions when TxQuery.PageSize is unset.
+	DefaultPageSize = 1000
+	// LatestBlock is the endblock Etherscan treats as "up to head".
+	LatestBlock = 99999999
+)
+
+// TxQuery selects the transactions walked by Transactions.
+type TxQuery struct {
+	Address    string
+	StartBlock uint64
+	// EndBlock defaults to LatestBlock.
+	EndBlock uint64
+	// PageSize is the offset per call, at most 10000.
+	PageSize int
+	// Sort is "asc" (default) or "desc".
+	Sort string
+}
+
+// Transactions walks every transaction matching q. Within Etherscan's 10,000
+// record window it pages normally; at the edge of the window it restarts the
+// query from the block of the last transaction seen, skipping the ones already
+// yielded from that block. Every page goes through the client's rate limiter.
+func (c *Client) Transactions(ctx context.Context, q TxQuery) iter.Seq2[Transaction, error] {
+	return func(yield func(Transaction, error) bool) {
+		if q.EndBlock == 0 {
+			q.EndBlock = LatestBlock
+		}
+		if q.PageSize <= 0 || q.PageSize > resultWindow {
+			q.PageSize = DefaultPageSize
+		}
+		desc := q.Sort == "desc"
+		if !desc {
+			q.Sort = "asc"
+		}
+		maxPages := resultWindow / q.PageSize
+		start, end := q.StartBlock, q.EndBlock
+
+		// seen holds the hashes yielded from the current boundary block
+		seen := make(map[string]bool)
+		var boundary uint64
+		for {
+			var last uint64
+			full := false
+			for page := 1; page <= maxPages; page++ {
+				txs, err := c.GetTransactionsByAddress(ctx, q.Address, int(start), int(end), page, q.PageSize, q.Sort)
+				if errors.Is(err, ErrNoResults) {
+					return
+				}
+				if err != nil {
+					yield(Transaction{}, err)
+					return
+				}
+				for _, tx := range txs {
+					block, err := strconv.ParseUint(tx.BlockNumber, 10, 64)
+					if err != nil {
+						yield(Transaction{}, fmt.Errorf("etherscan account/txlist: invalid block number %q", tx.BlockNumber))
+						return
+					}
+					last = block
+					if block != boundary {
+						boundary = block
+						clear(seen)
+					}
+					if seen[tx.Hash] {
+						continue
+					}
+					seen[tx.Hash] = true
+					if !yield(tx, nil) {
+						return
+					}
+				}
+				if len(txs) < q.PageSize {
+					return
+				}
+				full = page == maxPages
+			}
+			if !full {
+				return
+			}
+			// The window is exhausted: slide the range to restart at the last block seen
+			next := start
+			if desc {
+				next = end
+			}
+			if last == next {
+				yield(Transaction{}, fmt.Errorf("etherscan account/txlist: block %d has more than %d transactions", last, resultWindow))
+				return
+			}
+			if desc {
+				end = last
+			} else {
+				start = last
+			}
+		}
+	}
+}
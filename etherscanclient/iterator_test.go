@@ -0,0 +1,134 @@
+package etherscanclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// txlistServer emulates account/txlist over txs, which are in ascending block
+// order, including the 10,000 record window. It records each query's range.
+type txlistServer struct {
+	txs    []Transaction
+	mu     sync.Mutex
+	ranges [][2]int
+}
+
+func (s *txlistServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start, _ := strconv.Atoi(q.Get("startblock"))
+	end, _ := strconv.Atoi(q.Get("endblock"))
+	page, _ := strconv.Atoi(q.Get("page"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	if page*offset > resultWindow {
+		fmt.Fprint(w, `{"status":"0","message":"NOTOK","result":"Result window is too large, PageNo x Offset size must be less than or equal to 10000"}`)
+		return
+	}
+	s.mu.Lock()
+	s.ranges = append(s.ranges, [2]int{start, end})
+	s.mu.Unlock()
+	var match []Transaction
+	for _, tx := range s.txs {
+		if b, _ := strconv.Atoi(tx.BlockNumber); b >= start && b <= end {
+			match = append(match, tx)
+		}
+	}
+	if q.Get("sort") == "desc" {
+		slices.Reverse(match)
+	}
+	from := min((page-1)*offset, len(match))
+	result := match[from:min(from+offset, len(match))]
+	if len(result) == 0 {
+		fmt.Fprint(w, `{"status":"0","message":"No transactions found","result":[]}`)
+		return
+	}
+	b, _ := json.Marshal(result)
+	fmt.Fprintf(w, `{"status":"1","message":"OK","result":%s}`, b)
+}
+
+// newTxlistServer serves n transactions, three per block from block 100, so
+// each 10,000 record window ends partway through a block.
+func newTxlistServer(t *testing.T, n int) (*txlistServer, *Client) {
+	s := &txlistServer{}
+	for i := 0; i < n; i++ {
+		s.txs = append(s.txs, Transaction{BlockNumber: strconv.Itoa(100 + i/3), Hash: fmt.Sprintf("0x%064x", i)})
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, newTestClient(srv)
+}
+
+func TestTransactionsSlidePastResultWindow(t *testing.T) {
+	for _, sort := range []string{"asc", "desc"} {
+		t.Run(sort, func(t *testing.T) {
+			const n = 25000
+			s, c := newTxlistServer(t, n)
+			seen := make(map[string]int)
+			var order []string
+			for tx, err := range c.Transactions(context.Background(), TxQuery{Address: "0xv", PageSize: 5000, Sort: sort}) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				seen[tx.Hash]++
+				order = append(order, tx.Hash)
+			}
+			if len(order) != n || len(seen) != n {
+				t.Fatalf("yielded %d transactions, %d distinct; want each of %d once", len(order), len(seen), n)
+			}
+			want := make([]string, n)
+			for i, tx := range s.txs {
+				want[i] = tx.Hash
+			}
+			if sort == "desc" {
+				slices.Reverse(want)
+			}
+			if !slices.Equal(order, want) {
+				t.Fatal("transactions out of order")
+			}
+			// Every window restarts at the boundary block the previous one stopped in
+			var windows [][2]int
+			for _, r := range s.ranges {
+				if len(windows) == 0 || windows[len(windows)-1] != r {
+					windows = append(windows, r)
+				}
+			}
+			if len(windows) < 3 {
+				t.Fatalf("queried %d ranges, want the window to slide at least twice", len(windows))
+			}
+			for i := 1; i < len(windows); i++ {
+				prev, cur := windows[i-1], windows[i]
+				if sort == "asc" && (cur[0] <= prev[0] || cur[1] != prev[1]) {
+					t.Fatalf("window %d range %v after %v, want startblock to move forward", i, cur, prev)
+				}
+				if sort == "desc" && (cur[1] >= prev[1] || cur[0] != prev[0]) {
+					t.Fatalf("window %d range %v after %v, want endblock to move back", i, cur, prev)
+				}
+			}
+		})
+	}
+}
+
+func TestTransactionsRejectsOverfullBlock(t *testing.T) {
+	s, c := newTxlistServer(t, 0)
+	for i := 0; i < resultWindow+10; i++ {
+		s.txs = append(s.txs, Transaction{BlockNumber: "100", Hash: fmt.Sprintf("0x%064x", i)})
+	}
+	var err error
+	count := 0
+	for _, e := range c.Transactions(context.Background(), TxQuery{Address: "0xv", PageSize: 5000}) {
+		if e != nil {
+			err = e
+			break
+		}
+		count++
+	}
+	if err == nil || count != resultWindow {
+		t.Fatalf("yielded %d then %v, want the window then an error instead of looping", count, err)
+	}
+}
@@ -0,0 +1,96 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind before events are dropped.
+const subscriberBuffer = 32
+
+// Bus fans vault events out to in-process subscribers such as SSE connections.
+type Bus struct {
+	mu      sync.RWMutex
+	subs    map[chan models.Event]*subscription
+	dropped atomic.Uint64
+}
+
+// subscription is one subscriber's state. Publish waits for blocking
+// subscribers until they take the event or unsubscribe, which closes done.
+type subscription struct {
+	blocking bool
+	done     chan struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[chan models.Event]*subscription)}
+}
+
+// Publish delivers an event to every subscriber. Slow subscribers from Subscribe
+// miss events once their buffer is full; those from SubscribeBlocking make
+// Publish wait. A nil Bus discards events.
+func (b *Bus) Publish(e models.Event) {
+	if b == nil {
+		return
+	}
+	if e.Time == 0 {
+		e.Time = time.Now().Unix()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch, sub := range b.subs {
+		if sub.blocking {
+			select {
+			case ch <- e:
+			case <-sub.done:
+			}
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+			n := b.dropped.Add(1)
+			log.Printf("[Events] Dropping %s event for slow subscriber (%d dropped so far)", e.Type, n)
+		}
+	}
+}
+
+// Dropped returns how many events slow subscribers have missed.
+func (b *Bus) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// Subscribe returns a channel of events and a function that unsubscribes it.
+// Events are dropped while the channel's buffer is full.
+func (b *Bus) Subscribe() (<-chan models.Event, func()) {
+	return b.subscribe(false)
+}
+
+// SubscribeBlocking is like Subscribe, but the subscriber gets every event:
+// Publish waits for it while its buffer is full. It is for consumers that must
+// not miss events and keep up on average, such as the webhook dispatcher.
+func (b *Bus) SubscribeBlocking() (<-chan models.Event, func()) {
+	return b.subscribe(true)
+}
+
+func (b *Bus) subscribe(blocking bool) (<-chan models.Event, func()) {
+	ch := make(chan models.Event, subscriberBuffer)
+	sub := &subscription{blocking: blocking, done: make(chan struct{})}
+	b.mu.Lock()
+	b.subs[ch] = sub
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			// Release a Publish waiting on this subscriber before taking the lock
+			close(sub.done)
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+		})
+	}
+}
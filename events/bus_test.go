@@ -0,0 +1,64 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+func TestBusBlockingSubscriberGetsEveryEvent(t *testing.T) {
+	bus := NewBus()
+	blocking, unsubscribe := bus.SubscribeBlocking()
+	defer unsubscribe()
+	lossy, unsubscribeLossy := bus.Subscribe()
+	defer unsubscribeLossy()
+
+	const n = 10 * subscriberBuffer
+	got := make(chan int)
+	go func() {
+		count := 0
+		for range blocking {
+			if count++; count == n {
+				break
+			}
+		}
+		got <- count
+	}()
+	for i := 0; i < n; i++ {
+		bus.Publish(models.Event{Type: models.EventAlert, Data: i})
+	}
+	if count := <-got; count != n {
+		t.Fatalf("blocking subscriber got %d events, want %d", count, n)
+	}
+	if len(lossy) != subscriberBuffer {
+		t.Fatalf("lossy subscriber holds %d events, want a full buffer", len(lossy))
+	}
+	if dropped := bus.Dropped(); dropped != n-subscriberBuffer {
+		t.Fatalf("Dropped() = %d, want %d", dropped, n-subscriberBuffer)
+	}
+}
+
+func TestBusUnsubscribeReleasesPublish(t *testing.T) {
+	bus := NewBus()
+	_, unsubscribe := bus.SubscribeBlocking()
+	for i := 0; i < subscriberBuffer; i++ {
+		bus.Publish(models.Event{Type: models.EventAlert})
+	}
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(models.Event{Type: models.EventAlert})
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("Publish returned while a blocking subscriber's buffer was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unsubscribe()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish still blocked after the subscriber left")
+	}
+}
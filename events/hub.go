@@ -0,0 +1,87 @@
+package events
+
+import (
+	"log"
+	"sync"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// hubWindow is how many blocks below a vault's newest broadcast the hub
+// remembers, so a correction to one of them still gets through.
+const hubWindow = 128
+
+// RateHub fans rate updates out to local subscribers of one vault, such as SSE
+// connections. It is fed by a single Redis subscriber per replica, so the cost of
+// an update doesn't grow with the number of clients.
+type RateHub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan models.RateUpdate]struct{}
+	// seen holds the last rate broadcast for each recent block of a vault
+	seen map[string]map[uint64]models.RateUpdate
+	head map[string]uint64
+}
+
+func NewRateHub() *RateHub {
+	return &RateHub{
+		subs: make(map[string]map[chan models.RateUpdate]struct{}),
+		seen: make(map[string]map[uint64]models.RateUpdate),
+		head: make(map[string]uint64),
+	}
+}
+
+// Broadcast delivers rate to every subscriber of vaultID without blocking.
+// Repeats of a rate already broadcast for the same block, hash and status are
+// dropped, so replicas that all publish the same snapshot push it once. A new
+// hash or status for a recent block is a reorg correction or a confirmation and
+// is delivered; a block below the newest that was never broadcast comes from a
+// lagging replica and is dropped.
+func (h *RateHub) Broadcast(vaultID string, rate models.RateUpdate) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	seen := h.seen[vaultID]
+	if seen == nil {
+		seen = make(map[uint64]models.RateUpdate)
+		h.seen[vaultID] = seen
+	}
+	head, started := h.head[vaultID]
+	prev, ok := seen[rate.BlockNumber]
+	switch {
+	case ok && prev.BlockHash == rate.BlockHash && prev.Status == rate.Status:
+		return
+	case !ok && started && rate.BlockNumber < head:
+		return
+	}
+	seen[rate.BlockNumber] = rate
+	if rate.BlockNumber > head || !started {
+		h.head[vaultID] = rate.BlockNumber
+		for block := range seen {
+			if block+hubWindow < rate.BlockNumber {
+				delete(seen, block)
+			}
+		}
+	}
+	for ch := range h.subs[vaultID] {
+		select {
+		case ch <- rate:
+		default:
+			log.Printf("[Events] Dropping rate for %s for slow subscriber", vaultID)
+		}
+	}
+}
+
+// Subscribe returns a channel of vaultID's rates and a function that unsubscribes it.
+func (h *RateHub) Subscribe(vaultID string) (<-chan models.RateUpdate, func()) {
+	ch := make(chan models.RateUpdate, subscriberBuffer)
+	h.mu.Lock()
+	if h.subs[vaultID] == nil {
+		h.subs[vaultID] = make(map[chan models.RateUpdate]struct{})
+	}
+	h.subs[vaultID][ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs[vaultID], ch)
+		h.mu.Unlock()
+	}
+}
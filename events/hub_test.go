@@ -0,0 +1,44 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+func TestRateHubBroadcast(t *testing.T) {
+	hub := NewRateHub()
+	rates, unsubscribe := hub.Subscribe("v")
+	defer unsubscribe()
+
+	steps := []struct {
+		name      string
+		rate      models.RateUpdate
+		delivered bool
+	}{
+		{"first", models.RateUpdate{BlockNumber: 100, BlockHash: "0xa", Status: "pending"}, true},
+		{"repeat from another replica", models.RateUpdate{BlockNumber: 100, BlockHash: "0xa", Status: "pending"}, false},
+		{"newer block", models.RateUpdate{BlockNumber: 101, BlockHash: "0xb", Status: "pending"}, true},
+		{"reorg correction", models.RateUpdate{BlockNumber: 100, BlockHash: "0xc", Status: "pending"}, true},
+		{"confirmation", models.RateUpdate{BlockNumber: 100, BlockHash: "0xc", Status: "confirmed"}, true},
+		{"lagging replica", models.RateUpdate{BlockNumber: 99, BlockHash: "0xd", Status: "pending"}, false},
+		{"far ahead", models.RateUpdate{BlockNumber: 100 + 2*hubWindow, BlockHash: "0xe", Status: "pending"}, true},
+		{"forgotten block", models.RateUpdate{BlockNumber: 101, BlockHash: "0xf", Status: "pending"}, false},
+	}
+	for _, step := range steps {
+		hub.Broadcast("v", step.rate)
+		select {
+		case got := <-rates:
+			if !step.delivered {
+				t.Fatalf("%s: delivered %+v", step.name, got)
+			}
+			if got != step.rate {
+				t.Fatalf("%s: delivered %+v, want %+v", step.name, got, step.rate)
+			}
+		default:
+			if step.delivered {
+				t.Fatalf("%s: dropped", step.name)
+			}
+		}
+	}
+}
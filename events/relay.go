@@ -0,0 +1,55 @@
+package events
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// relayMemory is how many recent events a Relay remembers to drop repeats.
+const relayMemory = 1024
+
+// Relay merges this replica's vault events with the ones other replicas publish
+// on Redis and delivers each to its bus once. An event published here reaches it
+// twice, directly and back from Redis, and so may one several replicas raised.
+type Relay struct {
+	out   *Bus
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	order []string
+}
+
+func NewRelay(out *Bus) *Relay {
+	return &Relay{out: out, seen: make(map[string]struct{})}
+}
+
+// Publish delivers e unless an event with the same type, vault and data was
+// delivered recently. The time is left out, since replicas stamp their own.
+func (r *Relay) Publish(e models.Event) {
+	key := eventKey(e)
+	r.mu.Lock()
+	if _, ok := r.seen[key]; ok {
+		r.mu.Unlock()
+		return
+	}
+	r.seen[key] = struct{}{}
+	r.order = append(r.order, key)
+	if len(r.order) > relayMemory {
+		delete(r.seen, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.mu.Unlock()
+	r.out.Publish(e)
+}
+
+// eventKey identifies e by content. Data is round-tripped through JSON so a
+// local struct and the map decoded from Redis give the same key.
+func eventKey(e models.Event) string {
+	data, _ := json.Marshal(e.Data)
+	var v interface{}
+	if json.Unmarshal(data, &v) == nil {
+		data, _ = json.Marshal(v)
+	}
+	return e.Type + "\x00" + e.VaultID + "\x00" + string(data)
+}
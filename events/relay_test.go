@@ -0,0 +1,42 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+func TestRelayDeliversEachEventOnce(t *testing.T) {
+	bus := NewBus()
+	ch, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	relay := NewRelay(bus)
+
+	alert := models.Alert{ID: "v:1:rate_decrease", VaultID: "v", BlockNumber: 1, Kind: models.AlertRateDecrease, Value: 2.5}
+	relay.Publish(models.Event{Type: models.EventAlert, VaultID: "v", Time: 1, Data: alert})
+	// the same alert back from Redis, decoded as generic JSON and stamped by another replica
+	b, _ := json.Marshal(models.Event{Type: models.EventAlert, VaultID: "v", Time: 2, Data: alert})
+	var remote models.Event
+	if err := json.Unmarshal(b, &remote); err != nil {
+		t.Fatal(err)
+	}
+	relay.Publish(remote)
+	relay.Publish(models.Event{Type: models.EventAlert, VaultID: "other", Time: 1, Data: alert})
+
+	for _, want := range []string{"v", "other"} {
+		select {
+		case e := <-ch:
+			if e.VaultID != want {
+				t.Fatalf("got event for %s, want %s", e.VaultID, want)
+			}
+		default:
+			t.Fatalf("event for %s was not delivered", want)
+		}
+	}
+	select {
+	case e := <-ch:
+		t.Fatalf("repeat delivered: %+v", e)
+	default:
+	}
+}
@@ -1,93 +1,164 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
-	"math/big"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/Zarathos94/puffer/cache"
+	"github.com/Zarathos94/puffer/config"
+	"github.com/Zarathos94/puffer/etherscanclient"
+	"github.com/Zarathos94/puffer/events"
 	"github.com/Zarathos94/puffer/models"
 	"github.com/Zarathos94/puffer/routes"
+	"github.com/Zarathos94/puffer/rpcpool"
 	"github.com/Zarathos94/puffer/utils"
+	"github.com/Zarathos94/puffer/webhooks"
+	_ "github.com/lib/pq"
 	"github.com/rs/cors"
 )
 
 func main() {
-	ethURL := os.Getenv("ETH_RPC_URL")
-	if ethURL == "" {
-		log.Fatal("ETH_RPC_URL environment variable not set")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load vault config: %v", err)
 	}
 
+	// Redis is only dialed when it holds the rates or REDIS_ADDR is set. Without
+	// it, Redis-backed features (raw and 5m history, gaps, alerts, upgrade
+	// history, archive backfill, webhooks and cross-replica SSE) are disabled.
+	var c *cache.Cache
 	redisAddr := os.Getenv("REDIS_ADDR")
-	c, err := cache.NewCache(redisAddr)
-	if err != nil {
-		log.Fatalf("Failed to initialize Redis cache: %v", err)
+	if redisAddr != "" || cfg.Storage.Backend == config.StorageRedis {
+		c, err = cache.NewCache(redisAddr)
+		if err != nil {
+			log.Fatalf("Failed to initialize Redis cache: %v", err)
+		}
+	} else {
+		log.Printf("[Main] REDIS_ADDR not set; running without Redis-backed features")
 	}
 
-	rs, err := utils.NewRateServiceWithCache(ethURL, c)
+	store, err := openRateStore(cfg.Storage, c)
 	if err != nil {
-		log.Fatalf("Failed to initialize RateService: %v", err)
-	}
-
-	// Start background updater
-	go func() {
-		var lastCompletedHour int64 = 0
-		for {
-			now := time.Now()
-			// 1. Live update for current value
-			rs.FetchAndUpdate() // fetches from contract, caches as "latest"
-
-			// 2. Check if a new hour has completed
-			hour := now.Truncate(time.Hour).Unix()
-			completedHour := hour - 3600
-			if completedHour > lastCompletedHour {
-				// Cache the just-completed hour (using Etherscan block at start of completedHour)
-				blockNum, err := utils.GetBlockNumberByTimestamp(completedHour)
-				if err == nil {
-					assetsData, _ := rs.ParsedABI().Pack("totalAssets")
-					supplyData, _ := rs.ParsedABI().Pack("totalSupply")
-					assetsHex := "0x" + fmt.Sprintf("%x", assetsData)
-					supplyHex := "0x" + fmt.Sprintf("%x", supplyData)
-					assetsRes, err := utils.CallContractAtBlock(rs.Vault().Hex(), assetsHex, blockNum)
-					supplyRes, err2 := utils.CallContractAtBlock(rs.Vault().Hex(), supplyHex, blockNum)
-					if err == nil && err2 == nil && len(assetsRes) >= 3 && len(supplyRes) >= 3 {
-						assets := new(big.Int)
-						supply := new(big.Int)
-						assets.SetString(assetsRes[2:], 16)
-						supply.SetString(supplyRes[2:], 16)
-						var rate float64
-						if supply.Cmp(big.NewInt(0)) > 0 {
-							fAssets := new(big.Float).SetInt(assets)
-							fSupply := new(big.Float).SetInt(supply)
-							fRate := new(big.Float).Quo(fAssets, fSupply)
-							rate, _ = fRate.Float64()
-						}
-						update := models.RateUpdate{
-							Timestamp:   completedHour,
-							Rate:        rate,
-							Assets:      utils.FormatETH(assets),
-							TotalSupply: utils.FormatETH(supply),
-						}
-						rs.Cache().AddHistoricalRate(update)
-						// Remove oldest if >24
-						cutoff := hour - 24*3600
-						rs.Cache().CleanupOldRates(cutoff)
-					}
-				}
-				lastCompletedHour = completedHour
+		log.Fatalf("Failed to open %s rate store: %v", cfg.Storage.Backend, err)
+	}
+	if cfg.Storage.Backend == config.StorageRedis {
+		if id, ok := cfg.LegacyVaultID(); ok {
+			if err := c.MigrateLegacyKeys(id); err != nil {
+				log.Fatalf("Failed to migrate legacy keys to %s: %v", id, err)
+			}
+		}
+		for _, v := range cfg.Vaults {
+			if _, err := c.MigrateHistory(v.ID); err != nil {
+				log.Fatalf("Failed to migrate history for %s: %v", v.ID, err)
+			}
+		}
+	}
+	if cfg.Storage.SinkDSN != "" {
+		tiered, err := openSink(cfg.Storage, store, time.Duration(cfg.HistoryRetention))
+		if err != nil {
+			log.Fatalf("Failed to open SQL sink: %v", err)
+		}
+		for _, v := range cfg.Vaults {
+			if _, err := tiered.SeedSink(v.ID); err != nil {
+				log.Printf("[Sink] Failed to seed %s: %v", v.ID, err)
+			}
+		}
+		store = tiered
+	}
+
+	pools := make(map[string]*rpcpool.Pool)
+	for _, chain := range cfg.ChainNames() {
+		pool, err := rpcpool.Dial(context.Background(), chain, cfg.RPCURLs(chain), rpcpool.Options{
+			HedgeAfter:     time.Duration(cfg.RPCPool.HedgeAfter),
+			HealthInterval: time.Duration(cfg.RPCPool.HealthInterval),
+			AttemptTimeout: time.Duration(cfg.RPCPool.AttemptTimeout),
+		})
+		if err != nil {
+			log.Fatalf("Failed to connect to RPC for %s: %v", chain, err)
+		}
+		pools[chain] = pool
+	}
+
+	etherscan := etherscanclient.NewClient(etherscanclient.Options{
+		BaseURL:   cfg.Etherscan.BaseURL,
+		APIKey:    os.Getenv("ETHERSCAN_API_KEY"),
+		RateLimit: cfg.Etherscan.RateLimit,
+	})
+
+	bus := events.NewBus()
+	services := make([]*utils.RateService, 0, len(cfg.Vaults))
+	for _, v := range cfg.Vaults {
+		rs, err := utils.NewRateServiceWithStore(pools[v.Chain], v, c, store)
+		if err != nil {
+			log.Fatalf("Failed to initialize RateService for %s: %v", v.ID, err)
+		}
+		rs.SetConfirmationDepth(cfg.ConfirmationDepth)
+		rs.SetEventBus(bus)
+		rs.SetHistoryRetention(time.Duration(cfg.HistoryRetention))
+		rs.SetAnomalyConfig(utils.AnomalyConfig{
+			JumpBps:     cfg.Anomaly.JumpBps,
+			DecreaseBps: cfg.Anomaly.DecreaseBps,
+			ZScore:      cfg.Anomaly.ZScore,
+			Window:      cfg.Anomaly.Window,
+			MinSamples:  cfg.Anomaly.MinSamples,
+		})
+		rs.SetRollupConfig(utils.RollupConfig{
+			RawRetention:        time.Duration(cfg.Rollups.RawRetention),
+			FiveMinuteRetention: time.Duration(cfg.Rollups.FiveMinuteRetention),
+			HourlyRetention:     time.Duration(cfg.Rollups.HourlyRetention),
+			CompactEvery:        time.Duration(cfg.Rollups.CompactEvery),
+		})
+		if chainID, ok := cfg.ChainID(v.Chain); ok {
+			rs.SetEtherscan(etherscan.ForChain(chainID))
+			if cfg.BlockResolver == config.ResolverEtherscan {
+				rs.SetBlockResolver(utils.NewEtherscanBlockResolver(etherscan.ForChain(chainID)))
 			}
-			time.Sleep(15 * time.Second)
 		}
-	}()
+		services = append(services, rs)
+		// Start background updater
+		go runUpdater(rs, cfg)
+		go rs.WatchStaleness(context.Background(), time.Duration(cfg.Webhooks.StaleAfter))
+		go rs.RunCompaction(context.Background())
+		go rs.RunUpgradeIndexer(context.Background())
+		go rs.EventLogBackfillLast24Hours()
+		rs.ResumeArchiveBackfill()
+	}
 
-	routes.RegisterRateRoutes(rs)
+	hub := events.NewRateHub()
+	sseBus := bus
+	if c != nil {
+		var webhookClient *http.Client
+		if cfg.Webhooks.Timeout > 0 {
+			webhookClient = &http.Client{Timeout: time.Duration(cfg.Webhooks.Timeout)}
+		}
+		dispatcher := webhooks.NewDispatcher(c, webhooks.Options{
+			Client:      webhookClient,
+			MaxAttempts: cfg.Webhooks.MaxAttempts,
+		})
+		go dispatcher.Run(context.Background(), bus)
+		go c.SubscribeRates(context.Background(), hub.Broadcast)
+		sseBus = events.NewBus()
+		relay := events.NewRelay(sseBus)
+		go relayEvents(bus, c, relay)
+		go c.SubscribeEvents(context.Background(), relay.Publish)
+		routes.RegisterWebhookRoutes(c)
+	} else {
+		log.Printf("[Webhooks] Disabled without Redis")
+		go feedHub(bus, hub)
+	}
+	routes.RegisterRateRoutes(services, sseBus, hub)
+	routes.RegisterAdminRoutes(services)
+	routes.RegisterVaultRoutes(services)
+	routes.RegisterStatusRoutes()
 
 	handler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
 		AllowCredentials: true,
 	}).Handler(http.DefaultServeMux)
@@ -95,3 +166,105 @@ func main() {
 	log.Println("Listening on :8080...")
 	log.Fatal(http.ListenAndServe(":8080", handler))
 }
+
+// openRateStore returns the configured backend for rates and history.
+func openRateStore(cfg config.Storage, c *cache.Cache) (cache.RateStore, error) {
+	switch cfg.Backend {
+	case config.StorageMemory:
+		return cache.NewMemoryStore(), nil
+	case config.StoragePostgres:
+		db, err := sql.Open("postgres", cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return cache.NewSQLStore(db)
+	}
+	if c == nil {
+		return nil, fmt.Errorf("the redis backend needs REDIS_ADDR")
+	}
+	return c, nil
+}
+
+// feedHub broadcasts this replica's own rate events when there is no Redis
+// pub/sub to receive every replica's.
+func feedHub(bus *events.Bus, hub *events.RateHub) {
+	ch, _ := bus.Subscribe()
+	for e := range ch {
+		if rate, ok := e.Data.(models.RateUpdate); ok && e.Type == models.EventRate {
+			hub.Broadcast(e.VaultID, rate)
+		}
+	}
+}
+
+// relayEvents passes this replica's vault events to relay and publishes them on
+// Redis for the other replicas. Stale events stay local: every replica checks the
+// shared latest rate and raises its own.
+func relayEvents(bus *events.Bus, c *cache.Cache, relay *events.Relay) {
+	ch, _ := bus.Subscribe()
+	for e := range ch {
+		if e.Type == models.EventRate {
+			continue
+		}
+		relay.Publish(e)
+		if e.Type == models.EventStale {
+			continue
+		}
+		if err := c.PublishEvent(e); err != nil {
+			log.Printf("[PubSub] Failed to publish %s event for %s: %v", e.Type, e.VaultID, err)
+		}
+	}
+}
+
+// openSink connects the SQL sink and wraps hot with it. window is how long hot
+// keeps hourly history.
+func openSink(cfg config.Storage, hot cache.RateStore, window time.Duration) (*cache.TieredStore, error) {
+	db, err := sql.Open("postgres", cfg.SinkDSN)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := cache.NewSQLStore(db)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Timescale {
+		if err := sink.EnableTimescale(); err != nil {
+			return nil, fmt.Errorf("enable timescale: %w", err)
+		}
+	}
+	return cache.NewTieredStore(hot, sink, window), nil
+}
+
+// runUpdater keeps the latest rate fresh and records each completed hour for one vault.
+func runUpdater(rs *utils.RateService, cfg *config.Config) {
+	ctx := context.Background()
+	afterSnapshot := hourlySnapshot(rs)
+	interval := time.Duration(cfg.Updater.PollInterval)
+	if cfg.Updater.Mode == config.UpdaterBlocks {
+		rs.RunBlockUpdater(ctx, cfg.WSURL(rs.Info().Chain), cfg.Updater.EveryNBlocks, interval, afterSnapshot)
+		return
+	}
+	rs.RunPollUpdater(ctx, interval, afterSnapshot)
+}
+
+// hourlySnapshot returns a hook that caches each just-completed hour once.
+func hourlySnapshot(rs *utils.RateService) func() {
+	var lastCompletedHour int64 = 0
+	return func() {
+		now := time.Now()
+		// Check if a new hour has completed
+		hour := now.Truncate(time.Hour).Unix()
+		completedHour := hour - 3600
+		if completedHour > lastCompletedHour {
+			// Cache the just-completed hour at its last block
+			if err := rs.RecordHour(completedHour); err != nil {
+				log.Printf("[Hourly] Skipping hour %s for %s: %v", time.Unix(completedHour, 0).UTC().Format(time.RFC3339), rs.Info().ID, err)
+				if err := rs.RecordGap(completedHour, err); err != nil {
+					log.Printf("[Hourly] Failed to record gap for %s: %v", rs.Info().ID, err)
+				}
+			} else if err := rs.PruneHistory(); err != nil {
+				log.Printf("[Hourly] Failed to prune history for %s: %v", rs.Info().ID, err)
+			}
+			lastCompletedHour = completedHour
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+// Alert kinds raised by the anomaly detector.
+const (
+	AlertRateDecrease  = "rate_decrease"
+	AlertRateJump      = "rate_jump"
+	AlertAssetsOutlier = "assets_outlier"
+	AlertSupplyOutlier = "supply_outlier"
+)
+
+// Alert severities.
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Alert is an anomaly detected on a vault's rate, assets or supply.
+type Alert struct {
+	ID          string  `json:"id"`
+	VaultID     string  `json:"vault_id"`
+	Kind        string  `json:"kind"`
+	Severity    string  `json:"severity"`
+	Message     string  `json:"message"`
+	Timestamp   int64   `json:"timestamp"`
+	BlockNumber uint64  `json:"block_number,omitempty"`
+	Value       float64 `json:"value"`
+	Threshold   float64 `json:"threshold"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// APY is the annualized yield of a vault over one window.
+type APY struct {
+	Window string `json:"window"`
+	// From and To are the timestamps of the two rates the yield is measured between.
+	From      int64  `json:"from"`
+	To        int64  `json:"to"`
+	StartRate string `json:"start_rate"`
+	EndRate   string `json:"end_rate"`
+	// APR is simple annualized yield and APY compounds the window's growth over a year.
+	APR      float64  `json:"apr"`
+	APY      float64  `json:"apy"`
+	Coverage Coverage `json:"coverage"`
+}
+
+// Coverage describes the data behind a yield figure.
+type Coverage struct {
+	// StartSource is "onchain" for an exact read at the window start, or
+	// "history" when the nearest stored point was used instead. EndSource is
+	// "latest": the end is the latest stored snapshot.
+	StartSource string `json:"start_source"`
+	EndSource   string `json:"end_source"`
+	// HistoryPoints is how many stored hourly points fall in the window, out of ExpectedPoints.
+	HistoryPoints  int     `json:"history_points"`
+	ExpectedPoints int     `json:"expected_points"`
+	Ratio          float64 `json:"ratio"`
+	// LargestGap is the longest stretch in seconds without a stored point.
+	LargestGap int64 `json:"largest_gap"`
+}
@@ -0,0 +1,26 @@
+package models
+
+// Backfill job states.
+const (
+	BackfillRunning   = "running"
+	BackfillCompleted = "completed"
+	BackfillFailed    = "failed"
+)
+
+// BackfillProgress is the resumable checkpoint of an archive backfill job.
+type BackfillProgress struct {
+	VaultID string `json:"vault_id"`
+	State   string `json:"state"`
+	// From and To are the first and last hour of the job (unix seconds).
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	// Cursor is the next hour to read; every hour before it has been attempted.
+	Cursor      int64   `json:"cursor"`
+	Workers     int     `json:"workers"`
+	TotalHours  int     `json:"total_hours"`
+	DoneHours   int     `json:"done_hours"`
+	FailedHours []int64 `json:"failed_hours,omitempty"`
+	Error       string  `json:"error,omitempty"`
+	StartedAt   int64   `json:"started_at"`
+	UpdatedAt   int64   `json:"updated_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// Event types pushed to SSE subscribers.
+const (
+	EventReorg   = "reorg"
+	EventUpgrade = "upgrade"
+	EventAlert   = "alert"
+	EventStale   = "stale"
+	// EventRate carries every new RateUpdate in-process. SSE gets rates from
+	// Redis pub/sub instead, so every replica sees them.
+	EventRate = "rate"
+)
+
+// Event is a notification about a vault, delivered alongside rate updates.
+type Event struct {
+	Type    string      `json:"type"`
+	VaultID string      `json:"vault_id"`
+	Time    int64       `json:"time"`
+	Data    interface{} `json:"data"`
+}
+
+// ReorgEvent describes a history point rewritten after a chain reorganization.
+type ReorgEvent struct {
+	Timestamp   int64  `json:"timestamp"`
+	BlockNumber uint64 `json:"block_number"`
+	OldHash     string `json:"old_hash"`
+	NewHash     string `json:"new_hash"`
+	OldRate     string `json:"old_rate"`
+	NewRate     string `json:"new_rate"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// HistoryGap is an hour the hourly snapshot could not record, and why.
+type HistoryGap struct {
+	Hour       int64  `json:"hour"`
+	Reason     string `json:"reason"`
+	RecordedAt int64  `json:"recorded_at"`
+}
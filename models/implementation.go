@@ -0,0 +1,24 @@
+package models
+
+// Proxy change kinds, named after the ERC-1967 events that announce them.
+const (
+	ProxyUpgraded       = "upgraded"
+	ProxyAdminChanged   = "admin_changed"
+	ProxyBeaconUpgraded = "beacon_upgraded"
+)
+
+// ImplementationChange is one ERC-1967 proxy event for a vault.
+type ImplementationChange struct {
+	Kind string `json:"kind"`
+	// Address is the new implementation, admin or beacon.
+	Address string `json:"address"`
+	// Previous is the previous admin for admin_changed, or the implementation
+	// the vault ran before a live-detected upgrade.
+	Previous    string `json:"previous,omitempty"`
+	BlockNumber uint64 `json:"block_number"`
+	BlockTime   int64  `json:"block_time,omitempty"`
+	TxHash      string `json:"tx_hash,omitempty"`
+	LogIndex    uint   `json:"log_index"`
+	// SlotVerified is set when the ERC-1967 storage slot holds Address at BlockNumber.
+	SlotVerified bool `json:"slot_verified"`
+}
@@ -1,8 +1,33 @@
 package models
 
+// Snapshot finality states.
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+)
+
 type RateUpdate struct {
 	Timestamp   int64   `json:"timestamp"`
 	Rate        float64 `json:"rate"`
 	Assets      string  `json:"assets"`
 	TotalSupply string  `json:"total_supply"`
+	// Exact wei-denominated values behind the float fields.
+	AssetsWei      string `json:"assets_wei,omitempty"`
+	TotalSupplyWei string `json:"total_supply_wei,omitempty"`
+	// AssetsPerShare is convertToAssets(1e18) and SharesPerAsset is convertToShares(1e18), in wei.
+	AssetsPerShare string `json:"assets_per_share,omitempty"`
+	SharesPerAsset string `json:"shares_per_asset,omitempty"`
+	// RateDecimal is the exact rate as a decimal string.
+	RateDecimal string `json:"rate_decimal,omitempty"`
+	// RateMismatch is set when convertToAssets disagrees with totalAssets/totalSupply.
+	RateMismatch      bool    `json:"rate_mismatch"`
+	RateDivergenceBps float64 `json:"rate_divergence_bps,omitempty"`
+	// Block the snapshot was read at. Both totalAssets and totalSupply come from this block.
+	BlockNumber uint64 `json:"block_number,omitempty"`
+	BlockHash   string `json:"block_hash,omitempty"`
+	BlockTime   int64  `json:"block_time,omitempty"`
+	// Implementation is the ERC-1967 implementation the vault proxy pointed to at BlockNumber.
+	Implementation string `json:"implementation,omitempty"`
+	// Status is pending until the block is ConfirmationDepth blocks deep.
+	Status string `json:"status,omitempty"`
 }
@@ -0,0 +1,23 @@
+package models
+
+// History resolutions, finest first.
+const (
+	ResolutionRaw = "raw"
+	Resolution5m  = "5m"
+	Resolution1h  = "1h"
+	Resolution1d  = "1d"
+)
+
+// RateRollup summarizes the rates seen in one bucket. The embedded RateUpdate
+// is the bucket's closing snapshot with Timestamp set to the bucket start, so
+// rollups serialize as a superset of a plain history point.
+type RateRollup struct {
+	RateUpdate
+	Resolution string  `json:"resolution"`
+	Open       float64 `json:"open"`
+	High       float64 `json:"high"`
+	Low        float64 `json:"low"`
+	Close      float64 `json:"close"`
+	Average    float64 `json:"average"`
+	Samples    int     `json:"samples"`
+}
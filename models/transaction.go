@@ -0,0 +1,23 @@
+package models
+
+// VaultTransaction is a transaction sent to a vault, with its calldata decoded where the method is known.
+type VaultTransaction struct {
+	Hash        string `json:"hash"`
+	BlockNumber uint64 `json:"block_number"`
+	Timestamp   int64  `json:"timestamp"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Value       string `json:"value"`
+	Failed      bool   `json:"failed"`
+	GasUsed     string `json:"gas_used"`
+	// Selector is the first four bytes of the calldata; Method and Args are empty when it is unknown.
+	Selector string                 `json:"selector,omitempty"`
+	Method   string                 `json:"method,omitempty"`
+	Args     map[string]interface{} `json:"args,omitempty"`
+}
+
+// TransactionPage is one page of /vault/transactions. NextCursor is empty on the last page.
+type TransactionPage struct {
+	Transactions []VaultTransaction `json:"transactions"`
+	NextCursor   string             `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// Vault describes a single ERC-4626 vault tracked by the service.
+type Vault struct {
+	ID      string `json:"id"`
+	Chain   string `json:"chain"`
+	Address string `json:"address"`
+	Label   string `json:"label"`
+	// DeployBlock bounds archive backfills. When zero it is found by searching for the contract code.
+	DeployBlock uint64 `json:"deploy_block,omitempty"`
+}
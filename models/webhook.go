@@ -0,0 +1,88 @@
+package models
+
+// Webhook event types a subscription can choose from.
+const (
+	WebhookRateAnomaly       = "rate_anomaly"
+	WebhookStaleness         = "staleness"
+	WebhookProxyUpgrade      = "proxy_upgrade"
+	WebhookThresholdCrossing = "threshold_crossing"
+	WebhookReorg             = "reorg"
+)
+
+// WebhookEventTypes lists every type a subscription may request.
+var WebhookEventTypes = []string{
+	WebhookRateAnomaly,
+	WebhookStaleness,
+	WebhookProxyUpgrade,
+	WebhookThresholdCrossing,
+	WebhookReorg,
+}
+
+// Delivery states.
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryRetrying  = "retrying"
+	DeliveryDead      = "dead"
+)
+
+// WebhookSubscription is an endpoint that receives signed event deliveries.
+type WebhookSubscription struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	// EventTypes selects which events are delivered.
+	EventTypes []string `json:"event_types"`
+	// VaultIDs limits deliveries to these vaults; empty means all vaults.
+	VaultIDs []string `json:"vault_ids,omitempty"`
+	// RateThresholds are decimal rates; crossing one in either direction sends threshold_crossing.
+	RateThresholds []string `json:"rate_thresholds,omitempty"`
+	CreatedAt      int64    `json:"created_at"`
+}
+
+// WebhookPayload is the JSON body POSTed to a subscription.
+type WebhookPayload struct {
+	ID      string      `json:"id"`
+	Type    string      `json:"type"`
+	VaultID string      `json:"vault_id"`
+	Time    int64       `json:"time"`
+	Data    interface{} `json:"data"`
+}
+
+// WebhookDelivery is one delivery attempt in a subscription's log.
+type WebhookDelivery struct {
+	DeliveryID     string `json:"delivery_id"`
+	SubscriptionID string `json:"subscription_id"`
+	EventType      string `json:"event_type"`
+	Attempt        int    `json:"attempt"`
+	Status         string `json:"status"`
+	StatusCode     int    `json:"status_code,omitempty"`
+	Error          string `json:"error,omitempty"`
+	DurationMs     int64  `json:"duration_ms"`
+	Timestamp      int64  `json:"timestamp"`
+}
+
+// DeadLetter is a delivery that exhausted its retries.
+type DeadLetter struct {
+	SubscriptionID string         `json:"subscription_id"`
+	URL            string         `json:"url"`
+	Payload        WebhookPayload `json:"payload"`
+	Attempts       int            `json:"attempts"`
+	LastError      string         `json:"last_error"`
+	Timestamp      int64          `json:"timestamp"`
+}
+
+// ThresholdCrossing is the data of a threshold_crossing delivery.
+type ThresholdCrossing struct {
+	Threshold   string `json:"threshold"`
+	Direction   string `json:"direction"`
+	PrevRate    string `json:"prev_rate"`
+	Rate        string `json:"rate"`
+	BlockNumber uint64 `json:"block_number,omitempty"`
+}
+
+// StaleEvent reports that a vault has not been snapshotted recently.
+type StaleEvent struct {
+	LastUpdate int64 `json:"last_update"`
+	Age        int64 `json:"age_seconds"`
+	MaxAge     int64 `json:"max_age_seconds"`
+}
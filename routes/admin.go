@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Zarathos94/puffer/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// requireAdmin checks the bearer token against ADMIN_TOKEN. Admin routes are
+// disabled entirely when ADMIN_TOKEN is not set.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		writeError(w, http.StatusForbidden, "admin API disabled: ADMIN_TOKEN not set")
+		return false
+	}
+	// Compare in constant time so response timing doesn't leak the token
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid admin token")
+		return false
+	}
+	return true
+}
+
+// errorStatus is the status for a failed service call: 503 when the feature
+// needs Redis and none is configured, 500 otherwise.
+func errorStatus(err error) int {
+	if errors.Is(err, utils.ErrNoCache) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// parseTime accepts unix seconds, a YYYY-MM-DD date or an RFC 3339 timestamp.
+func parseTime(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t.Unix(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Unix(), nil
+	}
+	return 0, fmt.Errorf("invalid time %q: use unix seconds, YYYY-MM-DD or RFC 3339", s)
+}
+
+func RegisterAdminRoutes(services []*utils.RateService) {
+	vaults := newVaultLookup(services)
+
+	http.HandleFunc("/admin/backfill", func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+		rs, ok := vaults.resolve(w, r)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			p, err := rs.BackfillProgress()
+			if errors.Is(err, redis.Nil) {
+				writeError(w, http.StatusNotFound, "no backfill has run for this vault")
+				return
+			}
+			if err != nil {
+				writeError(w, errorStatus(err), err.Error())
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(p)
+		case http.MethodPost:
+			q := r.URL.Query()
+			from, err := parseTime(q.Get("from"))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "from: "+err.Error())
+				return
+			}
+			to := time.Now().Unix()
+			if v := q.Get("to"); v != "" {
+				if to, err = parseTime(v); err != nil {
+					writeError(w, http.StatusBadRequest, "to: "+err.Error())
+					return
+				}
+			}
+			workers, _ := strconv.Atoi(q.Get("workers"))
+			p, err := rs.StartArchiveBackfill(from, to, workers)
+			if errors.Is(err, utils.ErrBackfillRunning) {
+				writeError(w, http.StatusConflict, err.Error())
+				return
+			}
+			if errors.Is(err, utils.ErrNoCache) {
+				writeError(w, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(p)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "use GET or POST")
+		}
+	})
+}
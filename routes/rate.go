@@ -2,63 +2,268 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Zarathos94/puffer/cache"
+	"github.com/Zarathos94/puffer/events"
+	"github.com/Zarathos94/puffer/models"
 	"github.com/Zarathos94/puffer/utils"
 )
 
-func RegisterRateRoutes(rs *utils.RateService) {
+// vaultLookup resolves the ?vault= query parameter to a rate service.
+// Requests without a vault ID fall back to the first configured vault.
+type vaultLookup struct {
+	order []*utils.RateService
+	byID  map[string]*utils.RateService
+}
+
+func newVaultLookup(services []*utils.RateService) *vaultLookup {
+	l := &vaultLookup{order: services, byID: make(map[string]*utils.RateService)}
+	for _, rs := range services {
+		l.byID[rs.Info().ID] = rs
+	}
+	return l
+}
+
+func (l *vaultLookup) resolve(w http.ResponseWriter, r *http.Request) (*utils.RateService, bool) {
+	id := r.URL.Query().Get("vault")
+	if id == "" && len(l.order) > 0 {
+		return l.order[0], true
+	}
+	rs, ok := l.byID[id]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("unknown vault %q", id)})
+		return nil, false
+	}
+	return rs, true
+}
+
+// ssePayload is a rate update with the latest yield figures attached.
+type ssePayload struct {
+	models.RateUpdate
+	APY []models.APY `json:"apy,omitempty"`
+}
+
+// writeEvent sends a named SSE event so clients can tell it apart from rate updates.
+func writeEvent(w http.ResponseWriter, e models.Event) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+	w.(http.Flusher).Flush()
+}
+
+func RegisterRateRoutes(services []*utils.RateService, bus *events.Bus, hub *events.RateHub) {
+	vaults := newVaultLookup(services)
+
+	http.HandleFunc("/vaults", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		list := make([]models.Vault, 0, len(services))
+		for _, rs := range services {
+			list = append(list, rs.Info())
+		}
+		json.NewEncoder(w).Encode(list)
+	})
+
 	http.HandleFunc("/sse/rate", func(w http.ResponseWriter, r *http.Request) {
+		rs, ok := vaults.resolve(w, r)
+		if !ok {
+			return
+		}
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 		ctx := r.Context()
 		enc := json.NewEncoder(w)
+		vaultEvents, unsubscribe := bus.Subscribe()
+		defer unsubscribe()
+		rates, unsubscribeRates := hub.Subscribe(rs.Info().ID)
+		defer unsubscribeRates()
+		// Rates are pushed as they arrive; the ticker only keeps idle connections open
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+		sendRate := func(update models.RateUpdate) {
+			fmt.Fprintf(w, "data: ")
+			enc.Encode(ssePayload{RateUpdate: update, APY: rs.LatestAPY()})
+			fmt.Fprintf(w, "\n")
+			w.(http.Flusher).Flush()
+		}
+		// Start with the stored rate so clients don't wait for the next update
+		if update, err := rs.GetLatest(); err != nil {
+			fmt.Fprintf(w, "data: {\"error\": \"%v\"}\n\n", err)
+			w.(http.Flusher).Flush()
+		} else {
+			sendRate(update)
+		}
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			default:
-			}
-			update, err := rs.GetLatest()
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				fmt.Fprintf(w, "data: {\"error\": \"%v\"}\n\n", err)
+			case <-ticker.C:
+				fmt.Fprintf(w, ": keepalive\n\n")
 				w.(http.Flusher).Flush()
-				time.Sleep(15 * time.Second)
-				continue
+			case update := <-rates:
+				sendRate(update)
+			case e := <-vaultEvents:
+				if e.VaultID == rs.Info().ID && e.Type != models.EventRate {
+					writeEvent(w, e)
+				}
 			}
-			fmt.Fprintf(w, "data: ")
-			enc.Encode(update)
-			fmt.Fprintf(w, "\n")
-			w.(http.Flusher).Flush()
-			time.Sleep(15 * time.Second)
 		}
 	})
 
 	http.HandleFunc("/rate", func(w http.ResponseWriter, r *http.Request) {
+		rs, ok := vaults.resolve(w, r)
+		if !ok {
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
+		precision := utils.DefaultRatePrecision
+		if p := r.URL.Query().Get("precision"); p != "" {
+			n, err := strconv.Atoi(p)
+			if err != nil || n < 0 || n > utils.MaxRatePrecision {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("precision must be an integer between 0 and %d", utils.MaxRatePrecision)})
+				return
+			}
+			precision = n
+		}
 		update, err := rs.GetLatest()
+		if errors.Is(err, cache.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "no rate recorded yet for "+rs.Info().ID)
+			return
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 			return
 		}
+		if dec, err := utils.RateDecimal(update, precision); err == nil {
+			update.RateDecimal = dec
+		}
 		json.NewEncoder(w).Encode(update)
 	})
 
+	http.HandleFunc("/rate/apy", func(w http.ResponseWriter, r *http.Request) {
+		rs, ok := vaults.resolve(w, r)
+		if !ok {
+			return
+		}
+		windows := utils.DefaultAPYWindows
+		if v := r.URL.Query().Get("windows"); v != "" {
+			windows = nil
+			seen := make(map[string]bool)
+			for _, win := range strings.Split(v, ",") {
+				if _, err := utils.ParseWindow(win); err != nil {
+					writeError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+				if !seen[win] {
+					seen[win] = true
+					windows = append(windows, win)
+				}
+			}
+			if len(windows) > utils.MaxAPYWindows {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d windows per request", utils.MaxAPYWindows))
+				return
+			}
+		}
+		apy, err := rs.APY(windows)
+		if errors.Is(err, cache.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "no rate recorded yet for "+rs.Info().ID)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"vault_id": rs.Info().ID,
+			"windows":  apy,
+		})
+	})
+
 	http.HandleFunc("/rate/history", func(w http.ResponseWriter, r *http.Request) {
+		rs, ok := vaults.resolve(w, r)
+		if !ok {
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
-		to := time.Now().Unix()
-		from := to - 24*60*60
-		history, err := rs.GetHistory(from, to)
+		from, to, ok := parseRange(w, r)
+		if !ok {
+			return
+		}
+		resolution := r.URL.Query().Get("resolution")
+		if resolution == "" {
+			// Without a resolution the response keeps its original shape: the hourly points
+			history, err := rs.GetHistory(from, to)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			json.NewEncoder(w).Encode(history)
+			return
+		}
+		if !utils.ValidResolution(resolution) {
+			writeError(w, http.StatusBadRequest, "resolution must be auto, raw, 5m, 1h or 1d")
+			return
+		}
+		history, err := rs.GetHistoryAt(from, to, resolution)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			writeError(w, errorStatus(err), err.Error())
 			return
 		}
 		json.NewEncoder(w).Encode(history)
 	})
+
+	http.HandleFunc("/rate/gaps", func(w http.ResponseWriter, r *http.Request) {
+		rs, ok := vaults.resolve(w, r)
+		if !ok {
+			return
+		}
+		from, to, ok := parseRange(w, r)
+		if !ok {
+			return
+		}
+		gaps, err := rs.Gaps(from, to)
+		if err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gaps)
+	})
+}
+
+// parseRange reads the from/to parameters, defaulting to the last 24 hours.
+func parseRange(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	q := r.URL.Query()
+	to := time.Now().Unix()
+	if v := q.Get("to"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "to: "+err.Error())
+			return 0, 0, false
+		}
+		to = t
+	}
+	from := to - 24*60*60
+	if v := q.Get("from"); v != "" {
+		f, err := parseTime(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "from: "+err.Error())
+			return 0, 0, false
+		}
+		from = f
+	}
+	return from, to, true
 }
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Zarathos94/puffer/rpcpool"
+)
+
+func RegisterStatusRoutes() {
+	http.HandleFunc("/status/rpc", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rpcpool.Statuses())
+	})
+
+	// Counters for scraping; behind the admin token since they name the providers
+	http.HandleFunc("/admin/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		rpcpool.WriteMetrics(w)
+	})
+}
@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Zarathos94/puffer/etherscanclient"
+	"github.com/Zarathos94/puffer/models"
+	"github.com/Zarathos94/puffer/utils"
+)
+
+func RegisterVaultRoutes(services []*utils.RateService) {
+	vaults := newVaultLookup(services)
+
+	http.HandleFunc("/alerts", func(w http.ResponseWriter, r *http.Request) {
+		rs, ok := vaults.resolve(w, r)
+		if !ok {
+			return
+		}
+		q := r.URL.Query()
+		var since int64
+		if v := q.Get("since"); v != "" {
+			t, err := parseTime(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "since: "+err.Error())
+				return
+			}
+			since = t
+		}
+		limit := int64(100)
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			limit = n
+		}
+		alerts, err := rs.Alerts(since, limit)
+		if err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(alerts)
+	})
+
+	http.HandleFunc("/vault/implementations", func(w http.ResponseWriter, r *http.Request) {
+		rs, ok := vaults.resolve(w, r)
+		if !ok {
+			return
+		}
+		history, err := rs.ImplementationHistory()
+		if err != nil {
+			writeError(w, errorStatus(err), err.Error())
+			return
+		}
+		resp := struct {
+			VaultID string                        `json:"vault_id"`
+			Current string                        `json:"current,omitempty"`
+			History []models.ImplementationChange `json:"history"`
+		}{VaultID: rs.Info().ID, History: history}
+		if latest, err := rs.GetLatest(); err == nil {
+			resp.Current = latest.Implementation
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	http.HandleFunc("/vault/transactions", func(w http.ResponseWriter, r *http.Request) {
+		rs, ok := vaults.resolve(w, r)
+		if !ok {
+			return
+		}
+		params := r.URL.Query()
+		// Offsets into a growing list skip or repeat transactions, so pages are cursor-based only
+		if params.Has("page") {
+			writeError(w, http.StatusBadRequest, "page is not supported; pass next_cursor from the previous response as cursor")
+			return
+		}
+		q := utils.TransactionQuery{Sort: params.Get("sort"), Cursor: params.Get("cursor")}
+		if q.Sort != "" && q.Sort != "asc" && q.Sort != "desc" {
+			writeError(w, http.StatusBadRequest, "sort must be asc or desc")
+			return
+		}
+		for name, dst := range map[string]*uint64{"from_block": &q.FromBlock, "to_block": &q.ToBlock} {
+			if v := params.Get(name); v != "" {
+				n, err := strconv.ParseUint(v, 0, 64)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, name+" must be a block number")
+					return
+				}
+				*dst = n
+			}
+		}
+		if q.ToBlock != 0 && q.ToBlock < q.FromBlock {
+			writeError(w, http.StatusBadRequest, "to_block is before from_block")
+			return
+		}
+		if v := params.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > utils.MaxTransactionLimit {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", utils.MaxTransactionLimit))
+				return
+			}
+			q.Limit = n
+		}
+		page, err := rs.Transactions(r.Context(), q)
+		switch {
+		case errors.Is(err, utils.ErrEtherscanUnavailable):
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		case errors.Is(err, utils.ErrInvalidCursor):
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, etherscanclient.ErrRateLimited):
+			writeError(w, http.StatusTooManyRequests, "etherscan rate limit reached, retry later")
+			return
+		case err != nil:
+			// Upstream errors can quote provider details; keep them in the server log
+			log.Printf("[Transactions] Listing transactions for %s failed: %v", rs.Info().ID, err)
+			writeError(w, http.StatusBadGateway, "upstream unavailable")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	})
+}
@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Zarathos94/puffer/cache"
+	"github.com/Zarathos94/puffer/models"
+	"github.com/Zarathos94/puffer/webhooks"
+)
+
+// queryLimit parses the limit parameter, falling back to def.
+func queryLimit(r *http.Request, def int64) (int64, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+func RegisterWebhookRoutes(c *cache.Cache) {
+	http.HandleFunc("/admin/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			subs, err := c.ListWebhooks()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			// Secrets are only shown once, when the subscription is created
+			for i := range subs {
+				subs[i].Secret = ""
+			}
+			json.NewEncoder(w).Encode(subs)
+		case http.MethodPost:
+			var req models.WebhookSubscription
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+				return
+			}
+			sub, err := webhooks.NewSubscription(req)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := c.SaveWebhook(sub); err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(sub)
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				writeError(w, http.StatusBadRequest, "id is required")
+				return
+			}
+			found, err := c.DeleteWebhook(id)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if !found {
+				writeError(w, http.StatusNotFound, "unknown webhook "+id)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "use GET, POST or DELETE")
+		}
+	})
+
+	http.HandleFunc("/admin/webhooks/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			writeError(w, http.StatusBadRequest, "id is required")
+			return
+		}
+		limit, ok := queryLimit(r, 100)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		deliveries, err := c.GetDeliveries(id, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deliveries)
+	})
+
+	http.HandleFunc("/admin/webhooks/dead-letters", func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+		limit, ok := queryLimit(r, 100)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		dead, err := c.GetDeadLetters(limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dead)
+	})
+}
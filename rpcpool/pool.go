@@ -0,0 +1,392 @@
+package rpcpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	// ewmaAlpha weights the newest sample in latency and error-rate averages.
+	ewmaAlpha = 0.2
+	// cooldownAfter consecutive errors take an endpoint out of rotation for cooldownFor.
+	cooldownAfter = 3
+	cooldownFor   = 30 * time.Second
+	// lagPenalty is the latency charged per block an endpoint is behind the best head.
+	lagPenalty = 500 * time.Millisecond
+	// defaultHealthInterval is how often heads are probed when Options leaves it unset.
+	defaultHealthInterval = 15 * time.Second
+	// defaultAttemptTimeout bounds one endpoint's attempt when Options leaves it unset.
+	defaultAttemptTimeout = 5 * time.Second
+)
+
+// probeTimeout bounds dialing and each head probe, so one dead endpoint can't stall the pool.
+var probeTimeout = 10 * time.Second
+
+// errAttemptTimeout marks an attempt that ran out its own deadline while the
+// caller was still waiting. Unlike the caller's deadline it counts against the
+// endpoint and fails over.
+var errAttemptTimeout = errors.New("rpc attempt timed out")
+
+// Options tune routing. A zero HedgeAfter disables hedged requests.
+type Options struct {
+	// HedgeAfter sends a duplicate request to the next-best endpoint when the first is this slow.
+	HedgeAfter time.Duration
+	// HealthInterval is how often every endpoint's head is probed.
+	HealthInterval time.Duration
+	// AttemptTimeout bounds each endpoint's attempt at a call, so a hung endpoint
+	// fails over before the caller's own deadline.
+	AttemptTimeout time.Duration
+}
+
+// Pool routes JSON-RPC calls across several endpoints of one chain. Calls go
+// to the healthiest endpoint first and fail over to the next on error.
+type Pool struct {
+	name      string
+	endpoints []*endpoint
+	opts      Options
+
+	failovers atomic.Int64
+	hedges    atomic.Int64
+}
+
+type endpoint struct {
+	url    string
+	client *ethclient.Client
+
+	mu            sync.Mutex
+	latency       time.Duration
+	errorRate     float64
+	head          uint64
+	requests      int64
+	errors        int64
+	consecutive   int
+	cooldownUntil time.Time
+	lastError     string
+}
+
+// Dial connects to every URL and starts probing their heads in the background.
+func Dial(ctx context.Context, name string, urls []string, opts Options) (*Pool, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no RPC URLs for %s", name)
+	}
+	if opts.HealthInterval <= 0 {
+		opts.HealthInterval = defaultHealthInterval
+	}
+	if opts.AttemptTimeout <= 0 {
+		opts.AttemptTimeout = defaultAttemptTimeout
+	}
+	p := &Pool{name: name, opts: opts}
+	for _, u := range urls {
+		dialCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		client, err := ethclient.DialContext(dialCtx, u)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("dial %s: %s", redact(u), scrub(u, err))
+		}
+		p.endpoints = append(p.endpoints, &endpoint{url: u, client: client})
+	}
+	p.probe(ctx)
+	go p.monitor()
+	register(p)
+	return p, nil
+}
+
+// Name returns the chain name the pool serves.
+func (p *Pool) Name() string {
+	return p.name
+}
+
+func (p *Pool) monitor() {
+	ticker := time.NewTicker(p.opts.HealthInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), p.opts.HealthInterval)
+		p.probe(ctx)
+		cancel()
+	}
+}
+
+// probe records every endpoint's head so lagging nodes rank lower.
+func (p *Pool) probe(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, ep := range p.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+			start := time.Now()
+			head, err := ep.client.BlockNumber(probeCtx)
+			err = attemptError(ctx, probeCtx, err)
+			ep.observe(time.Since(start), err)
+			if err != nil {
+				log.Printf("[RPCPool] %s %s head probe failed: %s", p.name, redact(ep.url), scrub(ep.url, err))
+				return
+			}
+			ep.mu.Lock()
+			ep.head = head
+			ep.mu.Unlock()
+		}(ep)
+	}
+	wg.Wait()
+}
+
+func (ep *endpoint) observe(d time.Duration, err error) {
+	if errors.Is(err, context.Canceled) {
+		// Lost a hedge race; says nothing about the endpoint
+		return
+	}
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.requests++
+	sample := 0.0
+	if err != nil && retryable(err) {
+		sample = 1
+		ep.errors++
+		ep.consecutive++
+		ep.lastError = scrub(ep.url, err)
+		if ep.consecutive >= cooldownAfter {
+			ep.cooldownUntil = time.Now().Add(cooldownFor)
+		}
+		// A timed-out attempt took at least d, so a hung endpoint can't keep the lowest latency
+		if errors.Is(err, errAttemptTimeout) {
+			ep.addLatency(d)
+		}
+	} else {
+		ep.consecutive = 0
+		ep.addLatency(d)
+	}
+	ep.errorRate = ewmaAlpha*sample + (1-ewmaAlpha)*ep.errorRate
+}
+
+// addLatency folds d into the latency average; ep.mu must be held.
+func (ep *endpoint) addLatency(d time.Duration) {
+	if ep.latency == 0 {
+		ep.latency = d
+	} else {
+		ep.latency = time.Duration(ewmaAlpha*float64(d) + (1-ewmaAlpha)*float64(ep.latency))
+	}
+}
+
+// ranked orders endpoints from healthiest to least healthy. Endpoints in
+// cooldown go last so they are only tried when nothing else is left.
+func (p *Pool) ranked() []*endpoint {
+	best := p.bestHead()
+	now := time.Now()
+	type scored struct {
+		ep      *endpoint
+		score   float64
+		cooling bool
+	}
+	list := make([]scored, len(p.endpoints))
+	for i, ep := range p.endpoints {
+		ep.mu.Lock()
+		lag := headLag(best, ep.head)
+		list[i] = scored{
+			ep:      ep,
+			score:   (float64(ep.latency) + float64(lag)*float64(lagPenalty)) * (1 + 10*ep.errorRate),
+			cooling: now.Before(ep.cooldownUntil),
+		}
+		ep.mu.Unlock()
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].cooling != list[j].cooling {
+			return !list[i].cooling
+		}
+		return list[i].score < list[j].score
+	})
+	out := make([]*endpoint, len(list))
+	for i, s := range list {
+		out[i] = s.ep
+	}
+	return out
+}
+
+func (p *Pool) bestHead() uint64 {
+	var best uint64
+	for _, ep := range p.endpoints {
+		ep.mu.Lock()
+		if ep.head > best {
+			best = ep.head
+		}
+		ep.mu.Unlock()
+	}
+	return best
+}
+
+func headLag(best, head uint64) uint64 {
+	if head >= best {
+		return 0
+	}
+	return best - head
+}
+
+// retryable reports whether another endpoint might answer differently.
+// Reverts are deterministic and are returned as-is.
+func retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return !strings.Contains(strings.ToLower(err.Error()), "execution reverted")
+}
+
+// attemptError returns err as errAttemptTimeout when the attempt's own deadline
+// expired while parent was still live.
+func attemptError(parent, attempt context.Context, err error) error {
+	if err != nil && parent.Err() == nil && errors.Is(attempt.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", errAttemptTimeout, err)
+	}
+	return err
+}
+
+// call runs fn on the best endpoint, failing over on retryable errors and
+// hedging to the next endpoint when the first is slower than HedgeAfter.
+func call[T any](ctx context.Context, p *Pool, fn func(context.Context, *ethclient.Client) (T, error)) (T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		v   T
+		err error
+		ep  *endpoint
+	}
+	order := p.ranked()
+	results := make(chan result, len(order))
+	next, inflight := 0, 0
+	launch := func() {
+		ep := order[next]
+		next++
+		inflight++
+		go func() {
+			attemptCtx, cancel := context.WithTimeout(ctx, p.opts.AttemptTimeout)
+			defer cancel()
+			start := time.Now()
+			v, err := fn(attemptCtx, ep.client)
+			err = attemptError(ctx, attemptCtx, err)
+			ep.observe(time.Since(start), err)
+			results <- result{v, err, ep}
+		}()
+	}
+	launch()
+
+	var hedge <-chan time.Time
+	if p.opts.HedgeAfter > 0 && len(order) > 1 {
+		timer := time.NewTimer(p.opts.HedgeAfter)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+	var zero T
+	var lastErr error
+	for inflight > 0 {
+		select {
+		case <-hedge:
+			hedge = nil
+			if next < len(order) {
+				p.hedges.Add(1)
+				launch()
+			}
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				return r.v, nil
+			}
+			lastErr = scrubError(r.ep.url, r.err)
+			if !retryable(r.err) || ctx.Err() != nil {
+				return zero, lastErr
+			}
+			if inflight == 0 && next < len(order) {
+				p.failovers.Add(1)
+				launch()
+			}
+		}
+	}
+	return zero, lastErr
+}
+
+func (p *Pool) BlockNumber(ctx context.Context) (uint64, error) {
+	return call(ctx, p, func(ctx context.Context, c *ethclient.Client) (uint64, error) {
+		return c.BlockNumber(ctx)
+	})
+}
+
+func (p *Pool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return call(ctx, p, func(ctx context.Context, c *ethclient.Client) (*types.Header, error) {
+		return c.HeaderByNumber(ctx, number)
+	})
+}
+
+func (p *Pool) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return call(ctx, p, func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.CallContract(ctx, msg, blockNumber)
+	})
+}
+
+func (p *Pool) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return call(ctx, p, func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.CodeAt(ctx, account, blockNumber)
+	})
+}
+
+func (p *Pool) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	return call(ctx, p, func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.StorageAt(ctx, account, key, blockNumber)
+	})
+}
+
+func (p *Pool) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return call(ctx, p, func(ctx context.Context, c *ethclient.Client) ([]types.Log, error) {
+		return c.FilterLogs(ctx, q)
+	})
+}
+
+// scrub returns err's text with the endpoint's URL, which transport errors
+// quote, reduced to its redacted form. Stray copies of the path or query are
+// masked too.
+func scrub(raw string, err error) string {
+	msg := strings.ReplaceAll(err.Error(), raw, redact(raw))
+	if u, perr := url.Parse(raw); perr == nil {
+		msg = strings.ReplaceAll(msg, u.String(), redact(raw))
+		for _, secret := range []string{u.RawQuery, strings.Trim(u.Path, "/")} {
+			if secret != "" {
+				msg = strings.ReplaceAll(msg, secret, "<redacted>")
+			}
+		}
+	}
+	return msg
+}
+
+// scrubbedError is a call's error with the endpoint's URL redacted from its
+// text. Unwrap keeps the cause for errors.Is and errors.As.
+type scrubbedError struct {
+	msg string
+	err error
+}
+
+func (e *scrubbedError) Error() string { return e.msg }
+func (e *scrubbedError) Unwrap() error { return e.err }
+
+func scrubError(raw string, err error) error {
+	return &scrubbedError{msg: scrub(raw, err), err: err}
+}
+
+// redact strips paths and query strings, which often carry provider API keys.
+func redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "<invalid url>"
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,174 @@
+package rpcpool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+func TestScrubHidesKeys(t *testing.T) {
+	raw := "https://eth-mainnet.example.com/v2/s3cretKey?apikey=alsoSecret"
+	err := errors.New(`Post "` + raw + `": dial tcp: lookup eth-mainnet.example.com: no such host (v2/s3cretKey)`)
+	got := scrub(raw, err)
+	for _, secret := range []string{"s3cretKey", "alsoSecret"} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("scrubbed error %q still contains %q", got, secret)
+		}
+	}
+	if !strings.Contains(got, "https://eth-mainnet.example.com") {
+		t.Fatalf("scrubbed error %q lost the host", got)
+	}
+}
+
+// hungServer returns the address of a server that accepts connections and never answers.
+func hungServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// headServer answers every JSON-RPC request with block 16.
+func headServer(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID json.RawMessage `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x10"}`, req.ID)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// newTestPool builds a pool over urls in order, without probing them.
+func newTestPool(t *testing.T, urls ...string) *Pool {
+	t.Helper()
+	p := &Pool{name: "test", opts: Options{AttemptTimeout: 100 * time.Millisecond}}
+	for _, u := range urls {
+		client, err := ethclient.Dial(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(client.Close)
+		p.endpoints = append(p.endpoints, &endpoint{url: u, client: client})
+	}
+	return p
+}
+
+func TestCallFailsOverFromHungEndpoint(t *testing.T) {
+	p := newTestPool(t, "http://"+hungServer(t)+"/key", headServer(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	head, err := p.BlockNumber(ctx)
+	if err != nil || head != 16 {
+		t.Fatalf("BlockNumber = %d, %v; want 16 from the healthy endpoint", head, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("failover took %s", elapsed)
+	}
+	hung := p.endpoints[0]
+	if hung.errors != 1 || hung.consecutive != 1 || hung.errorRate == 0 {
+		t.Fatalf("hung endpoint errors = %d, consecutive = %d, rate = %v; want its timeout counted", hung.errors, hung.consecutive, hung.errorRate)
+	}
+	if p.failovers.Load() != 1 {
+		t.Fatalf("failovers = %d, want 1", p.failovers.Load())
+	}
+	if p.ranked()[0] == hung {
+		t.Fatal("hung endpoint still ranks first")
+	}
+}
+
+func TestCallErrorsAreScrubbed(t *testing.T) {
+	p := newTestPool(t, "http://"+hungServer(t)+"/s3cretKey", "http://"+hungServer(t)+"/?apikey=alsoSecret")
+	_, err := p.BlockNumber(context.Background())
+	if !errors.Is(err, errAttemptTimeout) {
+		t.Fatalf("err = %v, want errAttemptTimeout", err)
+	}
+	for _, secret := range []string{"s3cretKey", "alsoSecret"} {
+		if strings.Contains(err.Error(), secret) {
+			t.Fatalf("error %q contains %q", err, secret)
+		}
+	}
+}
+
+func TestCallerDeadlineDoesNotCount(t *testing.T) {
+	p := newTestPool(t, "http://"+hungServer(t))
+	p.opts.AttemptTimeout = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.BlockNumber(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the caller's deadline", err)
+	}
+	if ep := p.endpoints[0]; ep.errors != 0 || ep.consecutive != 0 {
+		t.Fatalf("caller's deadline counted against the endpoint: errors = %d", ep.errors)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	p := newTestPool(t, headServer(t))
+	p.name = "metrics-test"
+	register(p)
+	if _, err := p.BlockNumber(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	WriteMetrics(&b)
+	for _, want := range []string{
+		`rpc_pool_requests_total{chain="metrics-test",endpoint="` + redact(p.endpoints[0].url) + `"} 1`,
+		`rpc_pool_errors_total{chain="metrics-test",endpoint="` + redact(p.endpoints[0].url) + `"} 0`,
+		`rpc_pool_hedges_total{chain="metrics-test"} 0`,
+		`rpc_pool_failovers_total{chain="metrics-test"} 0`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Fatalf("metrics missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestDialBoundsHeadProbe(t *testing.T) {
+	addr := hungServer(t)
+	defer func(d time.Duration) { probeTimeout = d }(probeTimeout)
+	probeTimeout = 100 * time.Millisecond
+	start := time.Now()
+	p, err := Dial(context.Background(), "test", []string{"http://" + addr + "/key"}, Options{HealthInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Dial took %s with a hung endpoint", elapsed)
+	}
+	if s := p.Status(); len(s.Endpoints) != 1 || s.Endpoints[0].Head != 0 || strings.Contains(s.Endpoints[0].URL, "key") {
+		t.Fatalf("status = %+v, want one unprobed endpoint without the path", s)
+	}
+}
@@ -0,0 +1,103 @@
+package rpcpool
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// EndpointStatus is the health of one endpoint as reported by /status/rpc.
+type EndpointStatus struct {
+	URL         string  `json:"url"`
+	LatencyMs   float64 `json:"latency_ms"`
+	ErrorRate   float64 `json:"error_rate"`
+	Head        uint64  `json:"head"`
+	HeadLag     uint64  `json:"head_lag"`
+	Requests    int64   `json:"requests"`
+	Errors      int64   `json:"errors"`
+	CoolingDown bool    `json:"cooling_down"`
+	LastError   string  `json:"last_error,omitempty"`
+}
+
+// PoolStatus is the health of a pool, endpoints listed in routing order.
+type PoolStatus struct {
+	Chain     string           `json:"chain"`
+	Failovers int64            `json:"failovers"`
+	Hedges    int64            `json:"hedges"`
+	Endpoints []EndpointStatus `json:"endpoints"`
+}
+
+func (p *Pool) Status() PoolStatus {
+	best := p.bestHead()
+	now := time.Now()
+	s := PoolStatus{
+		Chain:     p.name,
+		Failovers: p.failovers.Load(),
+		Hedges:    p.hedges.Load(),
+	}
+	for _, ep := range p.ranked() {
+		ep.mu.Lock()
+		s.Endpoints = append(s.Endpoints, EndpointStatus{
+			URL:         redact(ep.url),
+			LatencyMs:   float64(ep.latency) / float64(time.Millisecond),
+			ErrorRate:   ep.errorRate,
+			Head:        ep.head,
+			HeadLag:     headLag(best, ep.head),
+			Requests:    ep.requests,
+			Errors:      ep.errors,
+			CoolingDown: now.Before(ep.cooldownUntil),
+			LastError:   ep.lastError,
+		})
+		ep.mu.Unlock()
+	}
+	return s
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []*Pool
+)
+
+func register(p *Pool) {
+	registryMu.Lock()
+	registry = append(registry, p)
+	registryMu.Unlock()
+}
+
+// Statuses reports every pool created by Dial.
+func Statuses() []PoolStatus {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	out := make([]PoolStatus, 0, len(registry))
+	for _, p := range registry {
+		out = append(out, p.Status())
+	}
+	return out
+}
+
+// WriteMetrics writes every pool's request, error, hedge and failover counters
+// in the Prometheus text format.
+func WriteMetrics(w io.Writer) {
+	statuses := Statuses()
+	fmt.Fprintln(w, "# TYPE rpc_pool_requests_total counter")
+	for _, s := range statuses {
+		for _, ep := range s.Endpoints {
+			fmt.Fprintf(w, "rpc_pool_requests_total{chain=%q,endpoint=%q} %d\n", s.Chain, ep.URL, ep.Requests)
+		}
+	}
+	fmt.Fprintln(w, "# TYPE rpc_pool_errors_total counter")
+	for _, s := range statuses {
+		for _, ep := range s.Endpoints {
+			fmt.Fprintf(w, "rpc_pool_errors_total{chain=%q,endpoint=%q} %d\n", s.Chain, ep.URL, ep.Errors)
+		}
+	}
+	fmt.Fprintln(w, "# TYPE rpc_pool_hedges_total counter")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "rpc_pool_hedges_total{chain=%q} %d\n", s.Chain, s.Hedges)
+	}
+	fmt.Fprintln(w, "# TYPE rpc_pool_failovers_total counter")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "rpc_pool_failovers_total{chain=%q} %d\n", s.Chain, s.Failovers)
+	}
+}
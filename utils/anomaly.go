@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"sync"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// AnomalyConfig sets the detector's thresholds.
+type AnomalyConfig struct {
+	// JumpBps flags any rate move larger than this many basis points between snapshots.
+	JumpBps float64
+	// DecreaseBps flags rate drops larger than this. Nil uses the default; an
+	// explicit zero flags every drop.
+	DecreaseBps *float64
+	// ZScore flags assets or supply changes this many standard deviations from the recent mean.
+	ZScore float64
+	// Window is how many recent changes the statistics are computed over.
+	Window int
+	// MinSamples is how many changes must be seen before outliers are flagged.
+	MinSamples int
+}
+
+// defaultDecreaseBps ignores drops from wei-level rounding in convertToAssets.
+var defaultDecreaseBps = 1.0
+
+// DefaultAnomalyConfig is used for any field left at zero, or nil for DecreaseBps.
+var DefaultAnomalyConfig = AnomalyConfig{
+	JumpBps:     50,
+	DecreaseBps: &defaultDecreaseBps,
+	ZScore:      4,
+	Window:      100,
+	MinSamples:  20,
+}
+
+// Detector compares each new snapshot with the previous one and with the
+// recent distribution of assets and supply changes.
+type Detector struct {
+	cfg AnomalyConfig
+
+	mu           sync.Mutex
+	prev         *models.RateUpdate
+	assetDeltas  []float64
+	supplyDeltas []float64
+}
+
+func NewDetector(cfg AnomalyConfig) *Detector {
+	if cfg.JumpBps <= 0 {
+		cfg.JumpBps = DefaultAnomalyConfig.JumpBps
+	}
+	if cfg.DecreaseBps == nil {
+		cfg.DecreaseBps = DefaultAnomalyConfig.DecreaseBps
+	}
+	if cfg.ZScore <= 0 {
+		cfg.ZScore = DefaultAnomalyConfig.ZScore
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultAnomalyConfig.Window
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = DefaultAnomalyConfig.MinSamples
+	}
+	return &Detector{cfg: cfg}
+}
+
+// Seed sets the snapshot the next Check is compared against, if none has been seen yet.
+func (d *Detector) Seed(u models.RateUpdate) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.prev == nil {
+		d.prev = &u
+	}
+}
+
+func (d *Detector) seeded() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.prev != nil
+}
+
+// Check returns the anomalies in u relative to the previous snapshot. Snapshots
+// at or before the previous block are ignored.
+func (d *Detector) Check(vaultID string, u models.RateUpdate) []models.Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prev := d.prev
+	if prev != nil && u.BlockNumber != 0 && u.BlockNumber <= prev.BlockNumber {
+		return nil
+	}
+	d.prev = &u
+	if prev == nil {
+		return nil
+	}
+	var alerts []models.Alert
+	newAlert := func(kind, severity, msg string, value, threshold float64) {
+		alerts = append(alerts, models.Alert{
+			ID:          fmt.Sprintf("%s:%d:%s", vaultID, u.BlockNumber, kind),
+			VaultID:     vaultID,
+			Kind:        kind,
+			Severity:    severity,
+			Message:     msg,
+			Timestamp:   blockOrSnapshotTime(u),
+			BlockNumber: u.BlockNumber,
+			Value:       value,
+			Threshold:   threshold,
+		})
+	}
+
+	prevRate, errPrev := exactRate(*prev)
+	curRate, errCur := exactRate(u)
+	if errPrev == nil && errCur == nil && prevRate.Sign() > 0 {
+		change := new(big.Rat).Sub(curRate, prevRate)
+		change.Quo(change, prevRate)
+		change.Mul(change, big.NewRat(10000, 1))
+		bps, _ := change.Float64()
+		if bps < 0 && -bps > *d.cfg.DecreaseBps {
+			newAlert(models.AlertRateDecrease, models.SeverityCritical,
+				fmt.Sprintf("rate fell %.4f bps from %s to %s", -bps, prevRate.FloatString(18), curRate.FloatString(18)),
+				bps, -*d.cfg.DecreaseBps)
+		}
+		if math.Abs(bps) > d.cfg.JumpBps {
+			newAlert(models.AlertRateJump, models.SeverityWarning,
+				fmt.Sprintf("rate moved %.4f bps in one snapshot", bps), bps, d.cfg.JumpBps)
+		}
+	}
+
+	if delta, ok := relativeChange(prev.AssetsWei, u.AssetsWei); ok {
+		if z, outlier := d.outlier(d.assetDeltas, delta); outlier {
+			newAlert(models.AlertAssetsOutlier, models.SeverityWarning,
+				fmt.Sprintf("totalAssets changed %.6f%% (z=%.2f)", delta*100, z), z, d.cfg.ZScore)
+		}
+		d.assetDeltas = d.push(d.assetDeltas, delta)
+	}
+	if delta, ok := relativeChange(prev.TotalSupplyWei, u.TotalSupplyWei); ok {
+		if z, outlier := d.outlier(d.supplyDeltas, delta); outlier {
+			newAlert(models.AlertSupplyOutlier, models.SeverityWarning,
+				fmt.Sprintf("totalSupply changed %.6f%% (z=%.2f)", delta*100, z), z, d.cfg.ZScore)
+		}
+		d.supplyDeltas = d.push(d.supplyDeltas, delta)
+	}
+	return alerts
+}
+
+// outlier reports the z-score of x against samples and whether it is outside bounds.
+func (d *Detector) outlier(samples []float64, x float64) (float64, bool) {
+	if len(samples) < d.cfg.MinSamples {
+		return 0, false
+	}
+	var mean, sq float64
+	for _, s := range samples {
+		mean += s
+	}
+	mean /= float64(len(samples))
+	for _, s := range samples {
+		sq += (s - mean) * (s - mean)
+	}
+	std := math.Sqrt(sq / float64(len(samples)))
+	if std == 0 {
+		// No variance to judge against, e.g. a vault with no activity yet
+		return 0, false
+	}
+	z := (x - mean) / std
+	return z, math.Abs(z) > d.cfg.ZScore
+}
+
+func (d *Detector) push(samples []float64, x float64) []float64 {
+	samples = append(samples, x)
+	if len(samples) > d.cfg.Window {
+		samples = samples[len(samples)-d.cfg.Window:]
+	}
+	return samples
+}
+
+// relativeChange returns (cur-prev)/prev for two wei strings.
+func relativeChange(prevWei, curWei string) (float64, bool) {
+	prev, ok1 := new(big.Int).SetString(prevWei, 10)
+	cur, ok2 := new(big.Int).SetString(curWei, 10)
+	if !ok1 || !ok2 || prev.Sign() == 0 {
+		return 0, false
+	}
+	r := new(big.Rat).SetFrac(new(big.Int).Sub(cur, prev), prev)
+	f, _ := r.Float64()
+	return f, true
+}
+
+func blockOrSnapshotTime(u models.RateUpdate) int64 {
+	if u.BlockTime != 0 {
+		return u.BlockTime
+	}
+	return u.Timestamp
+}
+
+// SetAnomalyConfig replaces the detector with one using cfg.
+func (rs *RateService) SetAnomalyConfig(cfg AnomalyConfig) {
+	rs.detector = NewDetector(cfg)
+}
+
+// detectAnomalies runs the detector on a new snapshot, then stores and publishes what it finds.
+func (rs *RateService) detectAnomalies(u models.RateUpdate) {
+	if !rs.detector.seeded() {
+		// Compare the first snapshot after a restart with the last one stored
+		if prev, err := rs.store.GetLatestRate(rs.info.ID); err == nil {
+			rs.detector.Seed(prev)
+		}
+	}
+	for _, alert := range rs.detector.Check(rs.info.ID, u) {
+		log.Printf("[Anomaly] %s %s: %s", rs.info.ID, alert.Kind, alert.Message)
+		if rs.cache != nil {
+			if err := rs.cache.AddAlert(alert); err != nil {
+				log.Printf("[Anomaly] Failed to store alert for %s: %v", rs.info.ID, err)
+			}
+		}
+		rs.events.Publish(models.Event{Type: models.EventAlert, VaultID: rs.info.ID, Data: alert})
+	}
+}
+
+// Alerts returns up to limit stored alerts at or after since, newest first.
+func (rs *RateService) Alerts(since, limit int64) ([]models.Alert, error) {
+	if rs.cache == nil {
+		return nil, ErrNoCache
+	}
+	return rs.cache.GetAlerts(rs.info.ID, since, limit)
+}
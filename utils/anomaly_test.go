@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+func TestDetectorDecreaseThreshold(t *testing.T) {
+	zero := 0.0
+	tests := []struct {
+		name     string
+		decrease *float64
+		perShare string // after 1.000000000000000000
+		want     bool
+	}{
+		{"default ignores a 1 wei drop", nil, "999999999999999999", false},
+		{"default flags a 2 bps drop", nil, "999800000000000000", true},
+		{"explicit zero flags a 1 wei drop", &zero, "999999999999999999", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(AnomalyConfig{DecreaseBps: tt.decrease})
+			d.Check("v", models.RateUpdate{BlockNumber: 1, AssetsPerShare: "1000000000000000000"})
+			alerts := d.Check("v", models.RateUpdate{BlockNumber: 2, AssetsPerShare: tt.perShare})
+			got := false
+			for _, a := range alerts {
+				got = got || a.Kind == models.AlertRateDecrease
+			}
+			if got != tt.want {
+				t.Fatalf("rate_decrease alert = %v, want %v (alerts %+v)", got, tt.want, alerts)
+			}
+		})
+	}
+}
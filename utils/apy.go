@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+const (
+	// WindowInception measures yield from the vault's deployment.
+	WindowInception = "inception"
+	// MaxAPYWindows caps the windows one /rate/apy request may ask for, since
+	// each can cost a block search and a read.
+	MaxAPYWindows = 8
+	// maxEdgeReads bounds the memo of window-start snapshots.
+	maxEdgeReads = 256
+	// apyCacheTTL is how long the default-window figures are reused.
+	apyCacheTTL    = 5 * time.Minute
+	secondsPerYear = 365 * 24 * 3600
+
+	sourceOnchain = "onchain"
+	sourceHistory = "history"
+	sourceLatest  = "latest"
+)
+
+// DefaultAPYWindows are reported by /rate/apy without a windows parameter and pushed over SSE.
+var DefaultAPYWindows = []string{"1d", "7d", "30d", WindowInception}
+
+// ParseWindow converts "7d", "12h" or "inception" to a duration. Inception returns zero.
+func ParseWindow(w string) (time.Duration, error) {
+	if w == WindowInception {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(w, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", w)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(w)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", w)
+	}
+	return d, nil
+}
+
+// APY computes annualized yield for each window. The end rate is the latest
+// stored snapshot, not a fresh read; the start rate is read on-chain at the block at the window start,
+// falling back to the nearest stored history point.
+func (rs *RateService) APY(windows []string) ([]models.APY, error) {
+	end, err := rs.GetLatest()
+	if err != nil {
+		return nil, fmt.Errorf("no latest rate: %w", err)
+	}
+	endRate, err := exactRate(end)
+	if err != nil {
+		return nil, err
+	}
+	endTime := end.BlockTime
+	if endTime == 0 {
+		endTime = end.Timestamp
+	}
+	out := make([]models.APY, 0, len(windows))
+	for _, w := range windows {
+		d, err := ParseWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		start, source, err := rs.windowStart(end.BlockNumber, endTime, d)
+		if err != nil {
+			return nil, fmt.Errorf("window %s: %w", w, err)
+		}
+		startRate, err := exactRate(start)
+		if err != nil {
+			return nil, fmt.Errorf("window %s: %w", w, err)
+		}
+		startTime := start.BlockTime
+		if startTime == 0 {
+			startTime = start.Timestamp
+		}
+		apy := models.APY{
+			Window:    w,
+			From:      startTime,
+			To:        endTime,
+			StartRate: startRate.FloatString(DefaultRatePrecision),
+			EndRate:   endRate.FloatString(DefaultRatePrecision),
+		}
+		if elapsed := endTime - startTime; elapsed > 0 && startRate.Sign() > 0 {
+			growth, _ := new(big.Rat).Quo(endRate, startRate).Float64()
+			years := float64(elapsed) / secondsPerYear
+			apy.APR = (growth - 1) / years
+			apy.APY = math.Pow(growth, 1/years) - 1
+		}
+		apy.Coverage = rs.coverage(startTime, endTime)
+		apy.Coverage.StartSource = source
+		apy.Coverage.EndSource = sourceLatest
+		out = append(out, apy)
+	}
+	return out, nil
+}
+
+// LatestAPY returns the default-window figures computed within the last few
+// minutes, refreshing them in the background when they are stale.
+func (rs *RateService) LatestAPY() []models.APY {
+	rs.apyMu.Lock()
+	cached, at := rs.apyCache, rs.apyAt
+	stale := time.Since(at) > apyCacheTTL && !rs.apyRefreshing
+	if stale {
+		rs.apyRefreshing = true
+	}
+	rs.apyMu.Unlock()
+	if stale {
+		go func() {
+			apy, err := rs.APY(DefaultAPYWindows)
+			rs.apyMu.Lock()
+			defer rs.apyMu.Unlock()
+			rs.apyRefreshing = false
+			if err != nil {
+				log.Printf("[APY] Failed to refresh %s: %v", rs.info.ID, err)
+				return
+			}
+			rs.apyCache, rs.apyAt = apy, time.Now()
+		}()
+	}
+	return cached
+}
+
+// windowStart returns the rate at the start of a window and where it came from.
+func (rs *RateService) windowStart(endBlock uint64, endTime int64, d time.Duration) (models.RateUpdate, string, error) {
+	update, err := rs.readWindowStart(endBlock, endTime, d)
+	if err == nil {
+		return update, sourceOnchain, nil
+	}
+	log.Printf("[APY] On-chain read at window start failed for %s, using history: %v", rs.info.ID, err)
+	var from int64
+	if d > 0 {
+		from = endTime - int64(d/time.Second)
+	}
+	points, herr := rs.store.GetHistoricalRates(rs.info.ID, from, endTime)
+	if herr != nil || len(points) == 0 {
+		return models.RateUpdate{}, "", fmt.Errorf("no on-chain read (%v) and no history in window", err)
+	}
+	return points[0], sourceHistory, nil
+}
+
+// readWindowStart reads the vault at the block at the window start, or at
+// deployment for inception. Reads at blocks confirmed below endBlock are
+// memoized, so repeated requests only pay for the block search.
+func (rs *RateService) readWindowStart(endBlock uint64, endTime int64, d time.Duration) (models.RateUpdate, error) {
+	var block uint64
+	var err error
+	if d == 0 {
+		block, err = rs.deployBlockNumber()
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		block, err = rs.resolver.BlockAtTime(ctx, endTime-int64(d/time.Second))
+		cancel()
+	}
+	if err != nil {
+		return models.RateUpdate{}, err
+	}
+	rs.edgeMu.Lock()
+	update, ok := rs.edgeReads[block]
+	rs.edgeMu.Unlock()
+	if ok {
+		return update, nil
+	}
+	header, err := rs.headerByNumber(block)
+	if err != nil {
+		return models.RateUpdate{}, err
+	}
+	update, err = rs.snapshotAt(header, int64(header.Time))
+	if err != nil {
+		return models.RateUpdate{}, err
+	}
+	// Blocks within the confirmation depth may still be reorged
+	if block+rs.confirmations <= endBlock {
+		rs.edgeMu.Lock()
+		if rs.edgeReads == nil || len(rs.edgeReads) >= maxEdgeReads {
+			rs.edgeReads = make(map[uint64]models.RateUpdate)
+		}
+		rs.edgeReads[block] = update
+		rs.edgeMu.Unlock()
+	}
+	return update, nil
+}
+
+// coverage counts the stored hourly points between from and to.
+func (rs *RateService) coverage(from, to int64) models.Coverage {
+	c := models.Coverage{ExpectedPoints: int((to - from) / 3600)}
+	points, err := rs.store.GetHistoricalRates(rs.info.ID, from, to)
+	if err != nil {
+		return c
+	}
+	c.HistoryPoints = len(points)
+	if c.ExpectedPoints > 0 {
+		c.Ratio = math.Min(1, float64(c.HistoryPoints)/float64(c.ExpectedPoints))
+	}
+	prev := from
+	for _, p := range points {
+		if gap := p.Timestamp - prev; gap > c.LargestGap {
+			c.LargestGap = gap
+		}
+		prev = p.Timestamp
+	}
+	if gap := to - prev; gap > c.LargestGap {
+		c.LargestGap = gap
+	}
+	return c
+}
+
+// exactRate returns a snapshot's rate as a big.Rat, preferring convertToAssets.
+func exactRate(u models.RateUpdate) (*big.Rat, error) {
+	s, err := RateDecimal(u, MaxRatePrecision)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid rate %q", s)
+	}
+	return r, nil
+}
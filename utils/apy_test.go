@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Zarathos94/puffer/cache"
+)
+
+func TestAPYWithoutLatestRate(t *testing.T) {
+	rs := newChainService(t, newFakeChain(10, 1_700_000_000, 12))
+	if _, err := rs.APY(DefaultAPYWindows); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("APY = %v, want cache.ErrNotFound", err)
+	}
+}
+
+func TestAPYMemoizesWindowStartReads(t *testing.T) {
+	chain := newFakeChain(1000, 1_700_000_000, 12)
+	rs := newChainService(t, chain)
+	head, _ := chain.HeaderByNumber(context.Background(), nil)
+	latest, err := rs.snapshotAt(head, int64(head.Time))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.store.SetLatestRate("v", latest); err != nil {
+		t.Fatal(err)
+	}
+	windows := []string{"1h", "2h"}
+	if _, err := rs.APY(windows); err != nil {
+		t.Fatal(err)
+	}
+	headers, views := chain.calls()
+	apy, err := rs.APY(windows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, v := chain.calls(); h != headers || v != views {
+		t.Fatalf("second APY made %d header and %d view calls, want none", h-headers, v-views)
+	}
+	for _, a := range apy {
+		if a.Coverage.StartSource != sourceOnchain {
+			t.Fatalf("window %s started from %s, want an on-chain read", a.Window, a.Coverage.StartSource)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+const (
+	// DefaultBackfillWorkers bounds concurrent archive reads when a job does not choose.
+	DefaultBackfillWorkers = 4
+	// MaxBackfillWorkers caps the worker count accepted from the admin API.
+	MaxBackfillWorkers = 32
+	// backfillBatchPerWorker is how many hours each worker handles between checkpoints.
+	backfillBatchPerWorker = 4
+	// maxRecordedFailures bounds the failed-hour list kept in the checkpoint.
+	maxRecordedFailures = 1000
+	// backfillClaimTTL is how long a backfill lease outlives a replica that
+	// stopped renewing it. The running job renews it every third of that.
+	backfillClaimTTL = time.Minute
+)
+
+// ErrBackfillRunning is returned when a vault already has a backfill in progress.
+var ErrBackfillRunning = errors.New("backfill already running")
+
+// StartArchiveBackfill reads totalAssets and totalSupply at every hourly boundary
+// block between from and to, clamped to the vault's deployment and the last
+// completed hour. It checkpoints to Redis after each batch and runs in the background.
+func (rs *RateService) StartArchiveBackfill(from, to int64, workers int) (models.BackfillProgress, error) {
+	if rs.cache == nil {
+		return models.BackfillProgress{}, ErrNoCache
+	}
+	if workers <= 0 {
+		workers = DefaultBackfillWorkers
+	}
+	if workers > MaxBackfillWorkers {
+		workers = MaxBackfillWorkers
+	}
+	// Round from up and to down to whole hours
+	from = (from + 3599) / 3600 * 3600
+	to = to - to%3600
+	if lastCompleted := time.Now().Truncate(time.Hour).Unix() - 3600; to > lastCompleted {
+		to = lastCompleted
+	}
+	deployTime, err := rs.deployTime()
+	if err != nil {
+		return models.BackfillProgress{}, fmt.Errorf("find deployment block: %w", err)
+	}
+	if deployStart := (deployTime + 3599) / 3600 * 3600; from < deployStart {
+		from = deployStart
+	}
+	if from > to {
+		return models.BackfillProgress{}, fmt.Errorf("empty range after clamping to deployment and last completed hour")
+	}
+	if rs.retention > 0 && from < time.Now().Add(-rs.retention).Unix() {
+		log.Printf("[ArchiveBackfill] Warning: %s retention is %s, older backfilled points will be pruned", rs.info.ID, rs.retention)
+	}
+	if err := rs.claimBackfill(); err != nil {
+		return models.BackfillProgress{}, err
+	}
+	now := time.Now().Unix()
+	p := models.BackfillProgress{
+		VaultID:    rs.info.ID,
+		State:      models.BackfillRunning,
+		From:       from,
+		To:         to,
+		Cursor:     from,
+		Workers:    workers,
+		TotalHours: int((to-from)/3600) + 1,
+		StartedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := rs.cache.SaveBackfillProgress(p); err != nil {
+		rs.releaseBackfill()
+		return models.BackfillProgress{}, err
+	}
+	go rs.runArchiveBackfill(p)
+	return p, nil
+}
+
+// ResumeArchiveBackfill continues a job that a previous process left running.
+func (rs *RateService) ResumeArchiveBackfill() {
+	if rs.cache == nil {
+		return
+	}
+	p, err := rs.cache.GetBackfillProgress(rs.info.ID)
+	if err != nil || p.State != models.BackfillRunning {
+		return
+	}
+	if err := rs.claimBackfill(); err != nil {
+		if !errors.Is(err, ErrBackfillRunning) {
+			log.Printf("[ArchiveBackfill] Failed to claim %s: %v", rs.info.ID, err)
+		}
+		return
+	}
+	log.Printf("[ArchiveBackfill] Resuming %s at hour=%d (%d/%d done)", rs.info.ID, p.Cursor, p.DoneHours, p.TotalHours)
+	go rs.runArchiveBackfill(p)
+}
+
+// BackfillProgress returns the latest archive backfill checkpoint.
+func (rs *RateService) BackfillProgress() (models.BackfillProgress, error) {
+	if rs.cache == nil {
+		return models.BackfillProgress{}, ErrNoCache
+	}
+	return rs.cache.GetBackfillProgress(rs.info.ID)
+}
+
+// claimBackfill takes the vault's backfill lease in Redis, so only one replica
+// runs a job at a time. It returns ErrBackfillRunning when any replica, this
+// one included, already holds it.
+func (rs *RateService) claimBackfill() error {
+	rs.backfillMu.Lock()
+	defer rs.backfillMu.Unlock()
+	if rs.backfilling {
+		return ErrBackfillRunning
+	}
+	owner := newClaimOwner()
+	ok, err := rs.cache.ClaimBackfill(rs.info.ID, owner, backfillClaimTTL)
+	if err != nil {
+		return fmt.Errorf("claim backfill: %w", err)
+	}
+	if !ok {
+		return ErrBackfillRunning
+	}
+	rs.backfilling, rs.backfillOwner = true, owner
+	return nil
+}
+
+func (rs *RateService) releaseBackfill() {
+	rs.backfillMu.Lock()
+	defer rs.backfillMu.Unlock()
+	if err := rs.cache.ReleaseBackfillClaim(rs.info.ID, rs.backfillOwner); err != nil {
+		log.Printf("[ArchiveBackfill] Failed to release claim on %s: %v", rs.info.ID, err)
+	}
+	rs.backfilling, rs.backfillOwner = false, ""
+}
+
+// holdBackfillClaim renews the lease until ctx is done. It closes lost if the
+// lease expired or was taken over, after which the job must stop.
+func (rs *RateService) holdBackfillClaim(ctx context.Context, lost chan<- struct{}) {
+	rs.backfillMu.Lock()
+	owner := rs.backfillOwner
+	rs.backfillMu.Unlock()
+	ticker := time.NewTicker(backfillClaimTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ok, err := rs.cache.RenewBackfillClaim(rs.info.ID, owner, backfillClaimTTL)
+		if err != nil {
+			log.Printf("[ArchiveBackfill] Failed to renew claim on %s: %v", rs.info.ID, err)
+			continue
+		}
+		if !ok {
+			close(lost)
+			return
+		}
+	}
+}
+
+// newClaimOwner returns a token unique to this claim.
+func newClaimOwner() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 8)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+func (rs *RateService) runArchiveBackfill(p models.BackfillProgress) {
+	defer rs.releaseBackfill()
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	lost := make(chan struct{})
+	go rs.holdBackfillClaim(ctx, lost)
+	batchSize := p.Workers * backfillBatchPerWorker
+	for p.Cursor <= p.To {
+		select {
+		case <-lost:
+			log.Printf("[ArchiveBackfill] Lost claim on %s at hour=%d, stopping", rs.info.ID, p.Cursor)
+			return
+		default:
+		}
+		var hours []int64
+		for h := p.Cursor; h <= p.To && len(hours) < batchSize; h += 3600 {
+			hours = append(hours, h)
+		}
+		failed, lastErr := rs.recordHours(hours, p.Workers)
+		p.Cursor = hours[len(hours)-1] + 3600
+		p.DoneHours += len(hours) - len(failed)
+		for _, h := range failed {
+			if len(p.FailedHours) < maxRecordedFailures {
+				p.FailedHours = append(p.FailedHours, h)
+			}
+		}
+		p.UpdatedAt = time.Now().Unix()
+		if len(failed) == len(hours) {
+			// A whole batch failing usually means the node cannot serve historical state
+			p.State = models.BackfillFailed
+			p.Error = lastErr.Error()
+			log.Printf("[ArchiveBackfill] %s stopped at hour=%d: %v", rs.info.ID, hours[0], lastErr)
+		}
+		if err := rs.cache.SaveBackfillProgress(p); err != nil {
+			log.Printf("[ArchiveBackfill] Failed to checkpoint %s: %v", rs.info.ID, err)
+		}
+		if p.State == models.BackfillFailed {
+			return
+		}
+	}
+	if err := rs.CompactRange(p.From, p.To); err != nil {
+		log.Printf("[ArchiveBackfill] Failed to roll up %s: %v", rs.info.ID, err)
+	}
+	p.State = models.BackfillCompleted
+	p.UpdatedAt = time.Now().Unix()
+	if err := rs.cache.SaveBackfillProgress(p); err != nil {
+		log.Printf("[ArchiveBackfill] Failed to checkpoint %s: %v", rs.info.ID, err)
+	}
+	log.Printf("[ArchiveBackfill] %s completed: %d/%d hours", rs.info.ID, p.DoneHours, p.TotalHours)
+}
+
+// recordHours reads each hour with at most workers reads in flight and returns the hours that failed.
+func (rs *RateService) recordHours(hours []int64, workers int) ([]int64, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		failed  []int64
+		lastErr error
+	)
+	sem := make(chan struct{}, workers)
+	for _, h := range hours {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(h int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := rs.RecordHour(h); err != nil {
+				log.Printf("[ArchiveBackfill] %s hour=%d: %v", rs.info.ID, h, err)
+				mu.Lock()
+				failed = append(failed, h)
+				lastErr = err
+				mu.Unlock()
+			}
+		}(h)
+	}
+	wg.Wait()
+	return failed, lastErr
+}
+
+// deployTime returns the timestamp of the vault's deployment block.
+func (rs *RateService) deployTime() (int64, error) {
+	block, err := rs.deployBlockNumber()
+	if err != nil {
+		return 0, err
+	}
+	header, err := rs.headerByNumber(block)
+	if err != nil {
+		return 0, err
+	}
+	return int64(header.Time), nil
+}
+
+// deployBlockNumber returns the vault's deployment block, searching for the
+// first block with contract code when the config does not give one.
+func (rs *RateService) deployBlockNumber() (uint64, error) {
+	rs.backfillMu.Lock()
+	block := rs.deployBlock
+	rs.backfillMu.Unlock()
+	if block == 0 {
+		block = rs.info.DeployBlock
+	}
+	if block == 0 {
+		found, err := rs.findDeployBlock()
+		if err != nil {
+			return 0, err
+		}
+		block = found
+	}
+	rs.backfillMu.Lock()
+	rs.deployBlock = block
+	rs.backfillMu.Unlock()
+	return block, nil
+}
+
+// findDeployBlock binary-searches for the first block where the vault has code.
+func (rs *RateService) findDeployBlock() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	head, err := rs.client.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	lo, hi := uint64(0), head
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		code, err := rs.client.CodeAt(ctx, rs.vault, new(big.Int).SetUint64(mid))
+		if err != nil {
+			return 0, fmt.Errorf("code at %d: %w", mid, err)
+		}
+		if len(code) > 0 {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	log.Printf("[ArchiveBackfill] %s deployed at block %d", rs.info.ID, lo)
+	return lo, nil
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Zarathos94/puffer/cache"
+	"github.com/Zarathos94/puffer/models"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// TestBackfillClaimIsSharedAcrossReplicas checks that two services on one Redis,
+// standing in for two replicas, never hold a vault's backfill at the same time.
+func TestBackfillClaimIsSharedAcrossReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replica := func() *RateService {
+		c, err := cache.NewCache(mr.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &RateService{info: models.Vault{ID: "v"}, cache: c, store: c}
+	}
+	a, b := replica(), replica()
+
+	if err := a.claimBackfill(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.claimBackfill(); !errors.Is(err, ErrBackfillRunning) {
+		t.Fatalf("second claim on the same replica = %v, want ErrBackfillRunning", err)
+	}
+	if err := b.claimBackfill(); !errors.Is(err, ErrBackfillRunning) {
+		t.Fatalf("claim on another replica = %v, want ErrBackfillRunning", err)
+	}
+	a.releaseBackfill()
+	if err := b.claimBackfill(); err != nil {
+		t.Fatalf("claim after release = %v", err)
+	}
+
+	// A replica that stops renewing loses the lease once it expires
+	mr.FastForward(backfillClaimTTL + time.Second)
+	if err := a.claimBackfill(); err != nil {
+		t.Fatalf("claim after the lease expired = %v", err)
+	}
+	if ok, err := b.cache.RenewBackfillClaim("v", b.backfillOwner, backfillClaimTTL); err != nil || ok {
+		t.Fatalf("renewing an expired lease = %v, %v; want false", ok, err)
+	}
+	b.releaseBackfill()
+	if err := b.claimBackfill(); !errors.Is(err, ErrBackfillRunning) {
+		t.Fatalf("stale release freed the new owner's lease: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/Zarathos94/puffer/etherscanclient"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// BlockResolver maps a unix timestamp to the last block mined at or before it.
+type BlockResolver interface {
+	BlockAtTime(ctx context.Context, ts int64) (uint64, error)
+}
+
+// HeaderReader is the subset of an Ethereum client the RPC resolver needs.
+type HeaderReader interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+const (
+	// avgSampleBlocks is how far back from head the average block time is measured.
+	avgSampleBlocks = 10000
+	// fallbackBlockTime is used when the chain is too short to measure.
+	fallbackBlockTime = 12.0
+	// maxMemoEntries bounds the header-time and result memos.
+	maxMemoEntries = 10000
+)
+
+// RPCBlockResolver finds blocks by binary-searching headers over RPC. It
+// extrapolates a first guess from the average block time, brackets the target
+// around it and memoizes both header timestamps and resolved results.
+type RPCBlockResolver struct {
+	client HeaderReader
+
+	mu      sync.Mutex
+	times   map[uint64]int64
+	results map[int64]uint64
+}
+
+func NewRPCBlockResolver(client HeaderReader) *RPCBlockResolver {
+	return &RPCBlockResolver{
+		client:  client,
+		times:   make(map[uint64]int64),
+		results: make(map[int64]uint64),
+	}
+}
+
+func (r *RPCBlockResolver) BlockAtTime(ctx context.Context, ts int64) (uint64, error) {
+	r.mu.Lock()
+	if n, ok := r.results[ts]; ok {
+		r.mu.Unlock()
+		return n, nil
+	}
+	r.mu.Unlock()
+
+	head, err := r.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	headNum, headTime := head.Number.Uint64(), int64(head.Time)
+	r.remember(headNum, headTime)
+	if ts >= headTime {
+		// Not memoized: a later block may still land at or before ts
+		return headNum, nil
+	}
+
+	avg, err := r.avgBlockTime(ctx, headNum, headTime)
+	if err != nil {
+		return 0, err
+	}
+	back := uint64(float64(headTime-ts) / avg)
+	guess := uint64(0)
+	if back < headNum {
+		guess = headNum - back
+	}
+
+	// Bracket the target so that time(lo) <= ts < time(hi)
+	lo, hi := guess, headNum
+	t, err := r.timeAt(ctx, guess)
+	if err != nil {
+		return 0, err
+	}
+	if t <= ts {
+		for step := uint64(64); ; step *= 2 {
+			next := lo + step
+			if next >= headNum {
+				break
+			}
+			if t, err = r.timeAt(ctx, next); err != nil {
+				return 0, err
+			}
+			if t > ts {
+				hi = next
+				break
+			}
+			lo = next
+		}
+	} else {
+		hi = guess
+		for step := uint64(64); ; step *= 2 {
+			if hi == 0 {
+				return 0, fmt.Errorf("timestamp %d is before the first block", ts)
+			}
+			next := uint64(0)
+			if step < hi {
+				next = hi - step
+			}
+			if t, err = r.timeAt(ctx, next); err != nil {
+				return 0, err
+			}
+			if t <= ts {
+				lo = next
+				break
+			}
+			hi = next
+		}
+	}
+
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if t, err = r.timeAt(ctx, mid); err != nil {
+			return 0, err
+		}
+		if t <= ts {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	r.mu.Lock()
+	if len(r.results) >= maxMemoEntries {
+		r.results = make(map[int64]uint64)
+	}
+	r.results[ts] = lo
+	r.mu.Unlock()
+	return lo, nil
+}
+
+// avgBlockTime measures seconds per block over the last avgSampleBlocks blocks.
+func (r *RPCBlockResolver) avgBlockTime(ctx context.Context, headNum uint64, headTime int64) (float64, error) {
+	sample := uint64(avgSampleBlocks)
+	if sample > headNum {
+		sample = headNum
+	}
+	if sample == 0 {
+		return fallbackBlockTime, nil
+	}
+	t, err := r.timeAt(ctx, headNum-sample)
+	if err != nil {
+		return 0, err
+	}
+	avg := float64(headTime-t) / float64(sample)
+	if avg <= 0 {
+		return fallbackBlockTime, nil
+	}
+	return avg, nil
+}
+
+func (r *RPCBlockResolver) timeAt(ctx context.Context, n uint64) (int64, error) {
+	r.mu.Lock()
+	t, ok := r.times[n]
+	r.mu.Unlock()
+	if ok {
+		return t, nil
+	}
+	header, err := r.client.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+	if err != nil {
+		return 0, fmt.Errorf("header %d: %w", n, err)
+	}
+	r.remember(n, int64(header.Time))
+	return int64(header.Time), nil
+}
+
+func (r *RPCBlockResolver) remember(n uint64, t int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.times) >= maxMemoEntries {
+		r.times = make(map[uint64]int64)
+	}
+	r.times[n] = t
+}
+
+// EtherscanBlockResolver resolves blocks through Etherscan's getblocknobytime API.
+type EtherscanBlockResolver struct {
+	client *etherscanclient.Client
+}
+
+func NewEtherscanBlockResolver(client *etherscanclient.Client) *EtherscanBlockResolver {
+	return &EtherscanBlockResolver{client: client}
+}
+
+func (r *EtherscanBlockResolver) BlockAtTime(ctx context.Context, ts int64) (uint64, error) {
+	return r.client.GetBlockNumberByTimestamp(ctx, ts)
+}
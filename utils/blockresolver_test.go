@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+	"testing"
+)
+
+// irregularChain has 2s blocks, then 20s blocks, with blocks 100-104 sharing a
+// timestamp, so a guess from the average block time lands far from the target.
+func irregularChain() *fakeChain {
+	c := newFakeChain(1000, 0, 1)
+	t := uint64(1_700_000_000)
+	for i, h := range c.headers {
+		switch {
+		case i == 0:
+		case i >= 101 && i <= 104:
+		case i < 500:
+			t += 2
+		default:
+			t += 20
+		}
+		h.Time = t
+	}
+	return c
+}
+
+func TestRPCBlockResolver(t *testing.T) {
+	regular := newFakeChain(1000, 1_700_000_000, 12)
+	irregular := irregularChain()
+	tests := []struct {
+		name  string
+		chain *fakeChain
+		ts    int64
+		want  uint64
+		err   bool
+	}{
+		{"before genesis", regular, 1_699_999_999, 0, true},
+		{"at genesis", regular, 1_700_000_000, 0, false},
+		{"exactly on a block", regular, 1_700_000_000 + 12*345, 345, false},
+		{"between blocks", regular, 1_700_000_000 + 12*345 + 7, 345, false},
+		{"just before a block", regular, 1_700_000_000 + 12*346 - 1, 345, false},
+		{"at head", regular, 1_700_000_000 + 12*999, 999, false},
+		{"after head", regular, 1_800_000_000, 999, false},
+		{"irregular, fast section", irregular, 1_700_000_000 + 2*50 + 1, 50, false},
+		{"irregular, shared timestamp", irregular, int64(irregular.headers[100].Time), 104, false},
+		{"irregular, slow section", irregular, int64(irregular.headers[700].Time) + 19, 700, false},
+		{"irregular, before genesis", irregular, 1_000, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewRPCBlockResolver(tt.chain).BlockAtTime(context.Background(), tt.ts)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("BlockAtTime(%d) = %d, want an error", tt.ts, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("BlockAtTime(%d) = %d, %v; want %d", tt.ts, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRPCBlockResolverMemoizes(t *testing.T) {
+	chain := newFakeChain(1000, 1_700_000_000, 12)
+	r := NewRPCBlockResolver(chain)
+	ts := int64(1_700_000_000 + 12*345 + 7)
+	if _, err := r.BlockAtTime(context.Background(), ts); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := chain.calls()
+	if got, err := r.BlockAtTime(context.Background(), ts); err != nil || got != 345 {
+		t.Fatalf("repeat BlockAtTime = %d, %v", got, err)
+	}
+	if headers, _ := chain.calls(); headers != first {
+		t.Fatalf("repeat lookup fetched %d headers, want none", headers-first)
+	}
+	// A nearby lookup reuses memoized header times
+	if _, err := r.BlockAtTime(context.Background(), ts+12*3); err != nil {
+		t.Fatal(err)
+	}
+	if headers, _ := chain.calls(); headers-first >= first {
+		t.Fatalf("nearby lookup fetched %d headers, the first took %d", headers-first, first)
+	}
+}
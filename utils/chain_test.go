@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Zarathos94/puffer/cache"
+	"github.com/Zarathos94/puffer/models"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var testVault = common.HexToAddress("0x2000000000000000000000000000000000000001")
+
+// fakeChain is an in-memory EthClient: headers at a fixed block time and a
+// vault whose views return the same totals at every block. It counts the
+// header and view calls made to it.
+type fakeChain struct {
+	mu      sync.Mutex
+	headers []*types.Header
+	assets  *big.Int
+	supply  *big.Int
+	logs    []types.Log
+	// maxLogRange makes FilterLogs reject wider queries, like a provider's limit
+	maxLogRange uint64
+	logRanges   [][2]uint64
+	headerCalls int
+	viewCalls   int
+}
+
+// newFakeChain returns a chain of n blocks, block i mined at start+i*blockTime.
+func newFakeChain(n int, start, blockTime uint64) *fakeChain {
+	c := &fakeChain{assets: big.NewInt(1), supply: big.NewInt(1)}
+	for i := 0; i < n; i++ {
+		c.headers = append(c.headers, &types.Header{
+			Number:     big.NewInt(int64(i)),
+			Time:       start + uint64(i)*blockTime,
+			Difficulty: big.NewInt(0),
+		})
+	}
+	return c
+}
+
+// reorg replaces block n with a sibling, which changes its hash.
+func (c *fakeChain) reorg(n uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := types.CopyHeader(c.headers[n])
+	h.Extra = append(h.Extra, 1)
+	c.headers[n] = h
+}
+
+func (c *fakeChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.headerCalls++
+	if number == nil {
+		return c.headers[len(c.headers)-1], nil
+	}
+	if !number.IsUint64() || number.Uint64() >= uint64(len(c.headers)) {
+		return nil, ethereum.NotFound
+	}
+	return c.headers[number.Uint64()], nil
+}
+
+func (c *fakeChain) BlockNumber(ctx context.Context) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return uint64(len(c.headers) - 1), nil
+}
+
+func (c *fakeChain) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.viewCalls++
+	method, err := vaultABI.MethodById(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	var v *big.Int
+	switch method.Name {
+	case "totalAssets":
+		v = c.assets
+	case "totalSupply":
+		v = c.supply
+	case "convertToAssets":
+		v = new(big.Int).Div(new(big.Int).Mul(oneShare, c.assets), c.supply)
+	case "convertToShares":
+		v = new(big.Int).Div(new(big.Int).Mul(oneShare, c.supply), c.assets)
+	}
+	return common.BigToHash(v).Bytes(), nil
+}
+
+func (c *fakeChain) CodeAt(ctx context.Context, account common.Address, block *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (c *fakeChain) StorageAt(ctx context.Context, account common.Address, key common.Hash, block *big.Int) ([]byte, error) {
+	return make([]byte, 32), nil
+}
+
+func (c *fakeChain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+	c.logRanges = append(c.logRanges, [2]uint64{from, to})
+	if c.maxLogRange > 0 && to-from+1 > c.maxLogRange {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+	var out []types.Log
+	for _, l := range c.logs {
+		if l.BlockNumber >= from && l.BlockNumber <= to {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func (c *fakeChain) calls() (headers, views int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.headerCalls, c.viewCalls
+}
+
+var vaultABI, _ = abi.JSON(strings.NewReader(abiJSON))
+
+// newChainService returns a service for vault "v" on chain with in-memory storage.
+func newChainService(t *testing.T, chain *fakeChain) *RateService {
+	t.Helper()
+	return &RateService{
+		client:    chain,
+		parsedABI: vaultABI,
+		info:      models.Vault{ID: "v", Address: testVault.Hex()},
+		vault:     testVault,
+		store:     cache.NewMemoryStore(),
+		batcher:   NewBatcher(chain),
+		resolver:  NewRPCBlockResolver(chain),
+		detector:  NewDetector(DefaultAnomalyConfig),
+		rollups:   DefaultRollupConfig,
+	}
+}
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// EventLogBackfillLast24Hours reconstructs and caches the last 24 hours of totalSupply/totalAssets using event logs.
+// Start it once the service is configured, since it reads the resolver and store.
+func (rs *RateService) EventLogBackfillLast24Hours() {
+	if err := rs.EventLogBackfill(24 * time.Hour); err != nil {
+		log.Printf("[EventLogBackfill] %s: %v", rs.info.ID, err)
+	}
+}
+
+// EventLogBackfill rebuilds hourly points for the given window by walking vault
+// events backwards from the current state. Supply is reversed through Transfer
+// mints and burns, assets through ERC-4626 Deposit and Withdraw amounts. Yield
+// that accrues without an event is not visible here, so each point carries the
+// rate of the next later snapshot until a live or hourly read replaces it.
+func (rs *RateService) EventLogBackfill(window time.Duration) error {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Hour)
+	windowStart := now.Add(-window).Unix()
+	log.Printf("[EventLogBackfill] Starting backfill of %s for %s", window, rs.info.ID)
+
+	latestHeader, err := rs.latestHeader()
+	if err != nil {
+		return fmt.Errorf("get latest block: %w", err)
+	}
+	latestBlock := latestHeader.Number.Uint64()
+	fromBlock, err := rs.resolver.BlockAtTime(ctx, windowStart)
+	if err != nil {
+		return fmt.Errorf("resolve window start: %w", err)
+	}
+	log.Printf("[EventLogBackfill] Scanning blocks %d - %d", fromBlock, latestBlock)
+
+	transferID := rs.parsedABI.Events["Transfer"].ID
+	depositID := rs.parsedABI.Events["Deposit"].ID
+	withdrawID := rs.parsedABI.Events["Withdraw"].ID
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{rs.vault},
+		Topics:    [][]common.Hash{{transferID, depositID, withdrawID}},
+	}
+	logs, err := FilterLogsChunked(ctx, rs.client, query, fromBlock, latestBlock)
+	if err != nil {
+		return fmt.Errorf("fetch logs: %w", err)
+	}
+	log.Printf("[EventLogBackfill] FilterLogs returned %d logs", len(logs))
+
+	// Logs come back in chain order; resolve each block's timestamp once
+	blockTimes := make(map[uint64]int64)
+	for _, l := range logs {
+		if _, ok := blockTimes[l.BlockNumber]; ok {
+			continue
+		}
+		header, err := rs.headerByNumber(l.BlockNumber)
+		if err != nil {
+			return fmt.Errorf("fetch block %d: %w", l.BlockNumber, err)
+		}
+		blockTimes[l.BlockNumber] = int64(header.Time)
+	}
+
+	// Start with the current state, pinned to the block the log scan ended at
+	state, err := rs.readState(latestHeader.Number)
+	if err != nil {
+		return fmt.Errorf("read vault state at block %d: %w", latestBlock, err)
+	}
+	currentAssets := new(big.Int).Set(state.assets)
+	currentSupply := new(big.Int).Set(state.supply)
+
+	// Points read directly at a block are more accurate than a reconstruction, so keep them
+	existing := make(map[int64]bool)
+	if points, err := rs.store.GetHistoricalRates(rs.info.ID, windowStart, now.Unix()); err == nil {
+		for _, p := range points {
+			existing[p.Timestamp] = true
+		}
+	}
+
+	// Walk hours from newest to oldest, undoing every event after each hour's end
+	// so the point holds the hour's closing state. The current hour belongs to
+	// the live updater and is skipped.
+	i := len(logs) - 1
+	count := 0
+	for h := now.Unix(); h >= windowStart; h -= 3600 {
+		for ; i >= 0 && blockTimes[logs[i].BlockNumber] >= h+3600; i-- {
+			if err := rs.reverseEvent(logs[i], currentAssets, currentSupply); err != nil {
+				log.Printf("[EventLogBackfill] Skipping log %s/%d: %v", logs[i].TxHash.Hex(), logs[i].Index, err)
+			}
+		}
+		if h == now.Unix() || existing[h] {
+			continue
+		}
+		update := NewRateUpdate(h, currentAssets, currentSupply)
+		update.Status = models.StatusConfirmed
+		if err := rs.store.AddHistoricalRate(rs.info.ID, update); err != nil {
+			log.Printf("[EventLogBackfill] AddHistoricalRate error for hour=%d: %v", h, err)
+			continue
+		}
+		count++
+	}
+	log.Printf("[EventLogBackfill] Inserted %d hourly points for %s", count, rs.info.ID)
+	if count > 0 {
+		if err := rs.CompactRange(windowStart, now.Unix()); err != nil {
+			log.Printf("[EventLogBackfill] Failed to roll up %s: %v", rs.info.ID, err)
+		}
+	}
+	return rs.PruneHistory()
+}
+
+// reverseEvent undoes one vault event on the running assets and supply totals.
+func (rs *RateService) reverseEvent(l types.Log, assets, supply *big.Int) error {
+	if len(l.Topics) == 0 || l.Removed {
+		return nil
+	}
+	switch l.Topics[0] {
+	case rs.parsedABI.Events["Transfer"].ID:
+		if len(l.Topics) != 3 {
+			return fmt.Errorf("transfer with %d topics", len(l.Topics))
+		}
+		out, err := rs.parsedABI.Unpack("Transfer", l.Data)
+		if err != nil {
+			return err
+		}
+		amount := out[0].(*big.Int)
+		from := common.BytesToAddress(l.Topics[1].Bytes())
+		to := common.BytesToAddress(l.Topics[2].Bytes())
+		if from == (common.Address{}) {
+			// Mint: reverse by subtracting
+			supply.Sub(supply, amount)
+		} else if to == (common.Address{}) {
+			// Burn: reverse by adding
+			supply.Add(supply, amount)
+		}
+	case rs.parsedABI.Events["Deposit"].ID:
+		out, err := rs.parsedABI.Unpack("Deposit", l.Data)
+		if err != nil {
+			return err
+		}
+		assets.Sub(assets, out[0].(*big.Int))
+	case rs.parsedABI.Events["Withdraw"].ID:
+		out, err := rs.parsedABI.Unpack("Withdraw", l.Data)
+		if err != nil {
+			return err
+		}
+		assets.Add(assets, out[0].(*big.Int))
+	}
+	return nil
+}
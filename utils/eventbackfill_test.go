@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// eventLog builds a vault log of event at block with indexed topics and the
+// remaining arguments as data.
+func eventLog(t *testing.T, block uint64, event string, topics []common.Hash, args ...interface{}) types.Log {
+	t.Helper()
+	ev := vaultABI.Events[event]
+	data, err := ev.Inputs.NonIndexed().Pack(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.Log{Address: testVault, Topics: append([]common.Hash{ev.ID}, topics...), Data: data, BlockNumber: block}
+}
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+func TestEventLogBackfillReversesEvents(t *testing.T) {
+	const blockTime = 12
+	hour := time.Now().Truncate(time.Hour).Unix()
+	start := hour - 6*3600
+	// Six hours of blocks ending at the current hour
+	chain := newFakeChain(6*3600/blockTime+1, uint64(start), blockTime)
+	chain.maxLogRange = 500
+	chain.assets, chain.supply = ether(1100), ether(1000)
+	blockAt := func(ts int64) uint64 { return uint64(ts-start) / blockTime }
+
+	user := common.BytesToHash(common.HexToAddress("0x4000000000000000000000000000000000000001").Bytes())
+	zero := common.Hash{}
+	deposit := blockAt(hour - 3*3600 - 1800)
+	withdraw := blockAt(hour - 3600 - 1800)
+	chain.logs = []types.Log{
+		eventLog(t, deposit, "Deposit", []common.Hash{user, user}, ether(220), ether(200)),
+		eventLog(t, deposit, "Transfer", []common.Hash{zero, user}, ether(200)),
+		eventLog(t, withdraw, "Withdraw", []common.Hash{user, user, user}, ether(55), ether(50)),
+		eventLog(t, withdraw, "Transfer", []common.Hash{user, zero}, ether(50)),
+	}
+
+	rs := newChainService(t, chain)
+	if err := rs.EventLogBackfill(6 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	points, err := rs.GetHistory(start, hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int64][2]int64{
+		hour - 3600:   {1100, 1000},
+		hour - 2*3600: {1100, 1000},
+		hour - 3*3600: {1155, 1050}, // before the withdrawal
+		hour - 4*3600: {1155, 1050},
+		hour - 5*3600: {935, 850}, // before the deposit
+		hour - 6*3600: {935, 850},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("got %d points, want %d: %+v", len(points), len(want), points)
+	}
+	for _, p := range points {
+		w, ok := want[p.Timestamp]
+		if !ok {
+			t.Fatalf("unexpected point at %d", p.Timestamp)
+		}
+		if p.AssetsWei != ether(w[0]).String() || p.TotalSupplyWei != ether(w[1]).String() {
+			t.Fatalf("hour %d: assets %s, supply %s; want %d and %d ether", (hour-p.Timestamp)/3600, p.AssetsWei, p.TotalSupplyWei, w[0], w[1])
+		}
+		if p.RateDecimal != "1.100000000000000000" || p.Status != models.StatusConfirmed {
+			t.Fatalf("hour %d: rate %s, status %s; want 1.1 confirmed", (hour-p.Timestamp)/3600, p.RateDecimal, p.Status)
+		}
+	}
+	if len(chain.logRanges) < 2 {
+		t.Fatal("the provider's range limit never split the log query")
+	}
+}
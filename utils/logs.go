@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// initialLogChunk is the first block range tried per FilterLogs request.
+	initialLogChunk = 2000
+	// maxLogChunk caps how far the range grows again after successful requests.
+	maxLogChunk = 50000
+)
+
+// LogFilterer is the subset of an Ethereum client needed to fetch logs.
+type LogFilterer interface {
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// rangeErrorHints are substrings providers use when a log query spans too many blocks or results.
+var rangeErrorHints = []string{
+	"block range",
+	"range too large",
+	"range is too large",
+	"query returned more than",
+	"too many results",
+	"too many logs",
+	"response size",
+	"limit exceeded",
+	"exceed maximum",
+	"query timeout",
+	"-32005",
+}
+
+// isRangeError reports whether err means the log query should be split.
+func isRangeError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, hint := range rangeErrorHints {
+		if strings.Contains(msg, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterLogsChunked fetches logs matching q between from and to (inclusive).
+// The range is split into chunks that halve whenever the provider rejects a
+// request as too large and grow again after each success.
+func FilterLogsChunked(ctx context.Context, client LogFilterer, q ethereum.FilterQuery, from, to uint64) ([]types.Log, error) {
+	var logs []types.Log
+	chunk := uint64(initialLogChunk)
+	for start := from; start <= to; {
+		end := start + chunk - 1
+		if end > to {
+			end = to
+		}
+		q.FromBlock = new(big.Int).SetUint64(start)
+		q.ToBlock = new(big.Int).SetUint64(end)
+		res, err := client.FilterLogs(ctx, q)
+		if err != nil {
+			if isRangeError(err) && end > start {
+				chunk = (end - start + 1) / 2
+				log.Printf("[FilterLogs] Range %d-%d rejected (%v), retrying with %d blocks", start, end, err, chunk)
+				continue
+			}
+			return nil, err
+		}
+		logs = append(logs, res...)
+		start = end + 1
+		if chunk < maxLogChunk {
+			chunk *= 2
+		}
+	}
+	return logs, nil
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestFilterLogsChunked(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxRange uint64
+		err      error
+		wantErr  bool
+	}{
+		{"fits", 0, nil, false},
+		{"range limit", 300, errors.New("eth_getLogs is limited to a 300 block range"), false},
+		{"result limit", 700, errors.New("query returned more than 10000 results"), false},
+		{"response size", 50, errors.New("response size exceeded"), false},
+		{"other error", 300, errors.New("internal error"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := newFakeChain(1, 0, 12)
+			for b := uint64(0); b <= 5000; b += 250 {
+				chain.logs = append(chain.logs, types.Log{BlockNumber: b})
+			}
+			filter := logFilterFunc(func(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+				if tt.maxRange > 0 && q.ToBlock.Uint64()-q.FromBlock.Uint64()+1 > tt.maxRange {
+					chain.mu.Lock()
+					chain.logRanges = append(chain.logRanges, [2]uint64{q.FromBlock.Uint64(), q.ToBlock.Uint64()})
+					chain.mu.Unlock()
+					return nil, tt.err
+				}
+				return chain.FilterLogs(ctx, q)
+			})
+			logs, err := FilterLogsChunked(context.Background(), filter, ethereum.FilterQuery{}, 100, 4900)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("error that isn't about the range was retried")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(logs) != 19 || logs[0].BlockNumber != 250 || logs[18].BlockNumber != 4750 {
+				t.Fatalf("got %d logs from %d to %d, want blocks 250 to 4750", len(logs), logs[0].BlockNumber, logs[len(logs)-1].BlockNumber)
+			}
+			// Accepted ranges tile [100, 4900] without gaps or overlaps
+			next := uint64(100)
+			for _, r := range chain.logRanges {
+				if tt.maxRange > 0 && r[1]-r[0]+1 > tt.maxRange {
+					continue
+				}
+				if r[0] != next {
+					t.Fatalf("range %v starts after a gap or overlap, want %d", r, next)
+				}
+				next = r[1] + 1
+			}
+			if next != 4901 {
+				t.Fatalf("ranges stop at %d, want 4900", next-1)
+			}
+		})
+	}
+}
+
+// logFilterFunc adapts a function to LogFilterer.
+type logFilterFunc func(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+
+func (f logFilterFunc) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return f(ctx, q)
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Multicall3Address is the canonical Multicall3 deployment, identical on most EVM chains.
+var Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+const multicall3ABIJSON = `[ { "inputs": [ { "components": [ { "internalType": "address", "name": "target", "type": "address" }, { "internalType": "bool", "name": "allowFailure", "type": "bool" }, { "internalType": "bytes", "name": "callData", "type": "bytes" } ], "internalType": "struct Multicall3.Call3[]", "name": "calls", "type": "tuple[]" } ], "name": "aggregate3", "outputs": [ { "components": [ { "internalType": "bool", "name": "success", "type": "bool" }, { "internalType": "bytes", "name": "returnData", "type": "bytes" } ], "internalType": "struct Multicall3.Result[]", "name": "returnData", "type": "tuple[]" } ], "stateMutability": "payable", "type": "function" } ]`
+
+var multicall3ABI = mustParseABI(multicall3ABIJSON)
+
+var errMulticallMissing = errors.New("multicall3 not deployed at block")
+
+func mustParseABI(s string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// ContractCaller is the subset of an Ethereum client the batcher needs.
+// Both *ethclient.Client and the go-ethereum simulated backend satisfy it.
+type ContractCaller interface {
+	CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// Call is a single view call to batch. Results are decoded through ABI.
+type Call struct {
+	Target common.Address
+	ABI    abi.ABI
+	Method string
+	Args   []interface{}
+}
+
+// CallResult holds the decoded outputs of one Call, or the reason it failed.
+type CallResult struct {
+	Values []interface{}
+	Err    error
+}
+
+// BigInt returns the first output of a call as a *big.Int.
+func (r CallResult) BigInt() (*big.Int, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	if len(r.Values) == 0 {
+		return nil, fmt.Errorf("call returned no values")
+	}
+	v, ok := r.Values[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("call returned %T, not *big.Int", r.Values[0])
+	}
+	return v, nil
+}
+
+// Batcher packs view calls into a single Multicall3 aggregate3 request and
+// falls back to individual eth_calls when Multicall3 is not deployed.
+type Batcher struct {
+	client  ContractCaller
+	address common.Address
+
+	mu        sync.Mutex
+	probed    bool
+	available bool
+}
+
+func NewBatcher(client ContractCaller) *Batcher {
+	return NewBatcherAt(client, Multicall3Address)
+}
+
+// NewBatcherAt uses a Multicall3 deployment at a non-canonical address.
+func NewBatcherAt(client ContractCaller, address common.Address) *Batcher {
+	return &Batcher{client: client, address: address}
+}
+
+// Call runs every call at the given block (nil means latest). The returned
+// slice lines up with calls; an error is returned only if the batch itself failed.
+func (b *Batcher) Call(ctx context.Context, block *big.Int, calls []Call) ([]CallResult, error) {
+	if len(calls) == 0 {
+		return nil, nil
+	}
+	if !b.multicallAvailable(ctx) {
+		return b.callEach(ctx, block, calls)
+	}
+	results, err := b.aggregate(ctx, block, calls)
+	if err == errMulticallMissing {
+		// Multicall3 was deployed after this block
+		return b.callEach(ctx, block, calls)
+	}
+	return results, err
+}
+
+// multicallAvailable reports whether Multicall3 has code at the latest block.
+// Only a successful probe is remembered; after an error the next call probes again.
+func (b *Batcher) multicallAvailable(ctx context.Context) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.probed {
+		code, err := b.client.CodeAt(ctx, b.address, nil)
+		if err != nil {
+			return false
+		}
+		b.probed, b.available = true, len(code) > 0
+	}
+	return b.available
+}
+
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+func (b *Batcher) aggregate(ctx context.Context, block *big.Int, calls []Call) ([]CallResult, error) {
+	packed := make([]multicall3Call, len(calls))
+	for i, c := range calls {
+		data, err := c.ABI.Pack(c.Method, c.Args...)
+		if err != nil {
+			return nil, fmt.Errorf("pack %s: %w", c.Method, err)
+		}
+		packed[i] = multicall3Call{Target: c.Target, AllowFailure: true, CallData: data}
+	}
+	input, err := multicall3ABI.Pack("aggregate3", packed)
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.client.CallContract(ctx, ethereum.CallMsg{To: &b.address, Data: input}, block)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errMulticallMissing
+	}
+	out, err := multicall3ABI.Unpack("aggregate3", res)
+	if err != nil {
+		return nil, fmt.Errorf("unpack aggregate3: %w", err)
+	}
+	raw := *abi.ConvertType(out[0], new([]multicall3Result)).(*[]multicall3Result)
+	if len(raw) != len(calls) {
+		return nil, fmt.Errorf("aggregate3 returned %d results for %d calls", len(raw), len(calls))
+	}
+	results := make([]CallResult, len(calls))
+	for i, r := range raw {
+		if !r.Success {
+			results[i].Err = fmt.Errorf("%s reverted", calls[i].Method)
+			continue
+		}
+		results[i] = decodeCall(calls[i], r.ReturnData)
+	}
+	return results, nil
+}
+
+func (b *Batcher) callEach(ctx context.Context, block *big.Int, calls []Call) ([]CallResult, error) {
+	results := make([]CallResult, len(calls))
+	for i, c := range calls {
+		data, err := c.ABI.Pack(c.Method, c.Args...)
+		if err != nil {
+			return nil, fmt.Errorf("pack %s: %w", c.Method, err)
+		}
+		target := c.Target
+		res, err := b.client.CallContract(ctx, ethereum.CallMsg{To: &target, Data: data}, block)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i] = decodeCall(c, res)
+	}
+	return results, nil
+}
+
+func decodeCall(c Call, data []byte) CallResult {
+	values, err := c.ABI.Unpack(c.Method, data)
+	if err != nil {
+		return CallResult{Err: fmt.Errorf("unpack %s: %w", c.Method, err)}
+	}
+	return CallResult{Values: values}
+}
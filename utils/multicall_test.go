@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/program"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+var (
+	testMulticall = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	testValue     = common.HexToAddress("0x1000000000000000000000000000000000000002")
+	testReverter  = common.HexToAddress("0x1000000000000000000000000000000000000003")
+)
+
+var valueABI, _ = abi.JSON(strings.NewReader(`[{"name":"value","type":"function","stateMutability":"view","inputs":[],"outputs":[{"type":"uint256"}]}]`))
+
+// aggregate3Code is a stand-in for Multicall3: it decodes aggregate3's Call3[],
+// staticcalls each target and ABI-encodes the Result[] the real contract
+// returns. allowFailure is ignored, as the batcher always sets it.
+func aggregate3Code() []byte {
+	const out = 0x200 // start of the returned Result[]
+	// build emits the code with the loop's exit at end and returns where the exit landed
+	build := func(end uint16) (*program.Program, uint16) {
+		p := program.New()
+		push2 := func(v uint16) { p.Op(vm.PUSH2).Append([]byte{byte(v >> 8), byte(v)}) }
+		// mem[0x00] = i, mem[0x20] = n, mem[0x40] = tail write pointer
+		p.Push(0x24).Op(vm.CALLDATALOAD).Push(0x20).Op(vm.MSTORE)
+		p.Push(0x20).Push(out).Op(vm.MSTORE)
+		p.Push(0x20).Op(vm.MLOAD).Push(out + 0x20).Op(vm.MSTORE)
+		p.Push(0x20).Op(vm.MLOAD).Push(32).Op(vm.MUL).Push(out + 0x40).Op(vm.ADD).Push(0x40).Op(vm.MSTORE)
+		_, loop := p.Jumpdest()
+		p.Push(0x20).Op(vm.MLOAD).Push(0).Op(vm.MLOAD).Op(vm.EQ)
+		push2(end)
+		p.Op(vm.JUMPI)
+		// mem[0x60] = calldata offset of element i
+		p.Push(0).Op(vm.MLOAD).Push(32).Op(vm.MUL).Push(0x44).Op(vm.ADD).Op(vm.CALLDATALOAD).Push(0x44).Op(vm.ADD).Push(0x60).Op(vm.MSTORE)
+		// mem[0x80] = calldata offset of its callData length word
+		p.Push(0x60).Op(vm.MLOAD).Push(0x40).Op(vm.ADD).Op(vm.CALLDATALOAD).Push(0x60).Op(vm.MLOAD).Op(vm.ADD).Push(0x80).Op(vm.MSTORE)
+		// head[i] = tail pointer relative to the head
+		p.Push(out + 0x40).Push(0x40).Op(vm.MLOAD).Op(vm.SUB)
+		p.Push(0).Op(vm.MLOAD).Push(32).Op(vm.MUL).Push(out + 0x40).Op(vm.ADD).Op(vm.MSTORE)
+		// copy callData to tail+0x60 and staticcall the target with it
+		p.Push(0x80).Op(vm.MLOAD).Op(vm.CALLDATALOAD)
+		p.Push(0x80).Op(vm.MLOAD).Push(0x20).Op(vm.ADD)
+		p.Push(0x40).Op(vm.MLOAD).Push(0x60).Op(vm.ADD)
+		p.Op(vm.CALLDATACOPY)
+		p.Push(0).Push(0)
+		p.Push(0x80).Op(vm.MLOAD).Op(vm.CALLDATALOAD)
+		p.Push(0x40).Op(vm.MLOAD).Push(0x60).Op(vm.ADD)
+		p.Push(0x60).Op(vm.MLOAD).Op(vm.CALLDATALOAD)
+		p.Op(vm.GAS, vm.STATICCALL)
+		// tail = success, 0x40, returndatasize, returndata
+		p.Push(0x40).Op(vm.MLOAD).Op(vm.MSTORE)
+		p.Push(0x40).Push(0x40).Op(vm.MLOAD).Push(0x20).Op(vm.ADD).Op(vm.MSTORE)
+		p.Op(vm.RETURNDATASIZE).Push(0x40).Op(vm.MLOAD).Push(0x40).Op(vm.ADD).Op(vm.MSTORE)
+		p.Push(0).Op(vm.RETURNDATASIZE).Push(0x40).Op(vm.MLOAD).Push(0x60).Op(vm.ADD).Op(vm.ADD).Op(vm.MSTORE)
+		p.Op(vm.RETURNDATASIZE).Push(0).Push(0x40).Op(vm.MLOAD).Push(0x60).Op(vm.ADD).Op(vm.RETURNDATACOPY)
+		// advance the tail pointer past the padded returndata, then i++
+		p.Push(32).Push(31).Op(vm.RETURNDATASIZE).Op(vm.ADD).Op(vm.DIV).Push(32).Op(vm.MUL)
+		p.Push(0x40).Op(vm.MLOAD).Op(vm.ADD).Push(0x60).Op(vm.ADD).Push(0x40).Op(vm.MSTORE)
+		p.Push(1).Push(0).Op(vm.MLOAD).Op(vm.ADD).Push(0).Op(vm.MSTORE)
+		p.Jump(loop)
+		_, exit := p.Jumpdest()
+		p.Push(out).Push(0x40).Op(vm.MLOAD).Op(vm.SUB).Push(out).Op(vm.RETURN)
+		return p, uint16(exit)
+	}
+	_, end := build(0)
+	p, _ := build(end)
+	return p.Bytes()
+}
+
+// countingCaller counts the eth_calls made through it and can fail CodeAt.
+type countingCaller struct {
+	ContractCaller
+	calls      atomic.Int32
+	codeAtErrs atomic.Int32
+}
+
+func (c *countingCaller) CallContract(ctx context.Context, call ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	c.calls.Add(1)
+	return c.ContractCaller.CallContract(ctx, call, block)
+}
+
+func (c *countingCaller) CodeAt(ctx context.Context, account common.Address, block *big.Int) ([]byte, error) {
+	if c.codeAtErrs.Add(-1) >= 0 {
+		return nil, errors.New("rpc unavailable")
+	}
+	return c.ContractCaller.CodeAt(ctx, account, block)
+}
+
+func newSimulatedCaller(t *testing.T) *countingCaller {
+	t.Helper()
+	value := program.New().Push(42).Push(0).Op(vm.MSTORE).Return(0, 32).Bytes()
+	revert := program.New().Push(0).Push(0).Op(vm.REVERT).Bytes()
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		testMulticall: {Code: aggregate3Code(), Balance: big.NewInt(0)},
+		testValue:     {Code: value, Balance: big.NewInt(0)},
+		testReverter:  {Code: revert, Balance: big.NewInt(0)},
+	})
+	t.Cleanup(func() { backend.Close() })
+	return &countingCaller{ContractCaller: backend.Client()}
+}
+
+var testCalls = []Call{
+	{Target: testValue, ABI: valueABI, Method: "value"},
+	{Target: testReverter, ABI: valueABI, Method: "value"},
+	{Target: testValue, ABI: valueABI, Method: "value"},
+}
+
+func checkTestResults(t *testing.T, results []CallResult, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(testCalls) {
+		t.Fatalf("got %d results for %d calls", len(results), len(testCalls))
+	}
+	for _, i := range []int{0, 2} {
+		if v, err := results[i].BigInt(); err != nil || v.Int64() != 42 {
+			t.Fatalf("result %d = %v, %v; want 42", i, v, err)
+		}
+	}
+	if results[1].Err == nil {
+		t.Fatal("call to the reverting contract succeeded")
+	}
+}
+
+func TestBatcherAggregate3(t *testing.T) {
+	client := newSimulatedCaller(t)
+	results, err := NewBatcherAt(client, testMulticall).Call(context.Background(), nil, testCalls)
+	checkTestResults(t, results, err)
+	if n := client.calls.Load(); n != 1 {
+		t.Fatalf("made %d eth_calls, want one aggregate3", n)
+	}
+}
+
+func TestBatcherFallsBackWithoutMulticall(t *testing.T) {
+	client := newSimulatedCaller(t)
+	results, err := NewBatcher(client).Call(context.Background(), nil, testCalls)
+	checkTestResults(t, results, err)
+	if n := client.calls.Load(); n != int32(len(testCalls)) {
+		t.Fatalf("made %d eth_calls, want one per call", n)
+	}
+}
+
+func TestBatcherRetriesFailedProbe(t *testing.T) {
+	client := newSimulatedCaller(t)
+	client.codeAtErrs.Store(1)
+	b := NewBatcherAt(client, testMulticall)
+	results, err := b.Call(context.Background(), nil, testCalls)
+	checkTestResults(t, results, err)
+	if n := client.calls.Load(); n != int32(len(testCalls)) {
+		t.Fatalf("made %d eth_calls while the probe failed, want one per call", n)
+	}
+	client.calls.Store(0)
+	results, err = b.Call(context.Background(), nil, testCalls)
+	checkTestResults(t, results, err)
+	if n := client.calls.Load(); n != 1 {
+		t.Fatalf("made %d eth_calls after the probe recovered, want one aggregate3", n)
+	}
+}
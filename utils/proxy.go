@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ERC1967 storage slots
+var (
+	implSlot   = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	adminSlot  = common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103")
+	beaconSlot = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+)
+
+const proxyABIJSON = `[ { "anonymous": false, "inputs": [ { "indexed": true, "internalType": "address", "name": "implementation", "type": "address" } ], "name": "Upgraded", "type": "event" }, { "anonymous": false, "inputs": [ { "indexed": false, "internalType": "address", "name": "previousAdmin", "type": "address" }, { "indexed": false, "internalType": "address", "name": "newAdmin", "type": "address" } ], "name": "AdminChanged", "type": "event" }, { "anonymous": false, "inputs": [ { "indexed": true, "internalType": "address", "name": "beacon", "type": "address" } ], "name": "BeaconUpgraded", "type": "event" } ]`
+
+var proxyABI = mustParseABI(proxyABIJSON)
+
+// upgradeIndexInterval is how often RunUpgradeIndexer scans for new proxy events.
+const upgradeIndexInterval = time.Minute
+
+// GetImplementationAddressAtBlock resolves the implementation address for a proxy at a given block
+func GetImplementationAddressAtBlock(client EthClient, proxy common.Address, blockNum *big.Int) (common.Address, error) {
+	return readSlotAddress(client, proxy, implSlot, blockNum)
+}
+
+// readSlotAddress reads an address stored in a proxy storage slot.
+func readSlotAddress(client EthClient, proxy common.Address, slot common.Hash, blockNum *big.Int) (common.Address, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	data, err := client.StorageAt(ctx, proxy, slot, blockNum)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(data) < 32 {
+		return common.Address{}, fmt.Errorf("invalid storage data")
+	}
+	return common.BytesToAddress(data[12:]), nil // last 20 bytes
+}
+
+// FetchHistoricalValueAtBlockProxy calls the implementation contract at a given block for a proxy
+func FetchHistoricalValueAtBlockProxy(client EthClient, proxy common.Address, abi abi.ABI, method string, blockNum *big.Int) *big.Int {
+	implAddr, err := GetImplementationAddressAtBlock(client, proxy, blockNum)
+	if err != nil {
+		log.Printf("[Proxy] Failed to resolve implementation at block %d: %v", blockNum.Int64(), err)
+		return nil
+	}
+	data, _ := abi.Pack(method)
+	res, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &implAddr, Data: data}, blockNum)
+	if err != nil {
+		log.Printf("[Proxy] eth_call error: %v", err)
+		return nil
+	}
+	var out []interface{}
+	err = abi.UnpackIntoInterface(&out, method, res)
+	if err != nil {
+		log.Printf("[Proxy] unpack error: %v", err)
+		return nil
+	}
+	if len(out) > 0 {
+		if v, ok := out[0].(*big.Int); ok {
+			return v
+		}
+		if v, ok := out[0].(big.Int); ok {
+			return &v
+		}
+	}
+	return nil
+}
+
+// RunUpgradeIndexer runs IndexUpgrades now and then every upgradeIndexInterval
+// until ctx is cancelled.
+func (rs *RateService) RunUpgradeIndexer(ctx context.Context) {
+	if rs.cache == nil {
+		return
+	}
+	ticker := time.NewTicker(upgradeIndexInterval)
+	defer ticker.Stop()
+	for {
+		if err := rs.IndexUpgrades(); err != nil {
+			log.Printf("[Proxy] Failed to index upgrades for %s: %v", rs.info.ID, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// IndexUpgrades records ERC-1967 Upgraded, AdminChanged and BeaconUpgraded
+// events from the last indexed block (or the vault's deployment) up to the
+// confirmed head. Each change is checked against the matching storage slot.
+// Admin and beacon changes found after the first scan are published as upgrade
+// events; implementation upgrades were already announced by the snapshot that
+// saw them (see noteImplementation), so they are only recorded. The first scan
+// only fills in the past.
+func (rs *RateService) IndexUpgrades() error {
+	if !rs.upgradeMu.TryLock() {
+		// Another scan is already running
+		return nil
+	}
+	defer rs.upgradeMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	head, err := rs.client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	if head < rs.confirmations {
+		return nil
+	}
+	to := head - rs.confirmations
+	if rs.cache == nil {
+		return nil
+	}
+	cursor, err := rs.cache.GetUpgradeCursor(rs.info.ID)
+	if err != nil {
+		return err
+	}
+	from := cursor + 1
+	if cursor == 0 {
+		if from, err = rs.deployBlockNumber(); err != nil {
+			return fmt.Errorf("find deployment block: %w", err)
+		}
+	}
+	if from > to {
+		return nil
+	}
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{rs.vault},
+		Topics: [][]common.Hash{{
+			proxyABI.Events["Upgraded"].ID,
+			proxyABI.Events["AdminChanged"].ID,
+			proxyABI.Events["BeaconUpgraded"].ID,
+		}},
+	}
+	logs, err := FilterLogsChunked(ctx, rs.client, query, from, to)
+	if err != nil {
+		return err
+	}
+	for _, l := range logs {
+		change, err := rs.decodeProxyLog(l)
+		if err != nil {
+			log.Printf("[Proxy] Skipping log %s/%d for %s: %v", l.TxHash.Hex(), l.Index, rs.info.ID, err)
+			continue
+		}
+		if err := rs.cache.AddImplementationChange(rs.info.ID, change); err != nil {
+			return err
+		}
+		log.Printf("[Proxy] %s %s -> %s at block %d (slot verified: %v)", rs.info.ID, change.Kind, change.Address, change.BlockNumber, change.SlotVerified)
+		if cursor > 0 && change.Kind != models.ProxyUpgraded {
+			rs.events.Publish(models.Event{Type: models.EventUpgrade, VaultID: rs.info.ID, Data: change})
+		}
+	}
+	return rs.cache.SetUpgradeCursor(rs.info.ID, to)
+}
+
+// decodeProxyLog turns a proxy event into an ImplementationChange and verifies it against storage.
+func (rs *RateService) decodeProxyLog(l types.Log) (models.ImplementationChange, error) {
+	change := models.ImplementationChange{
+		BlockNumber: l.BlockNumber,
+		TxHash:      l.TxHash.Hex(),
+		LogIndex:    l.Index,
+	}
+	var slot common.Hash
+	switch l.Topics[0] {
+	case proxyABI.Events["Upgraded"].ID:
+		if len(l.Topics) != 2 {
+			return change, fmt.Errorf("upgraded with %d topics", len(l.Topics))
+		}
+		change.Kind = models.ProxyUpgraded
+		change.Address = common.BytesToAddress(l.Topics[1].Bytes()).Hex()
+		slot = implSlot
+	case proxyABI.Events["BeaconUpgraded"].ID:
+		if len(l.Topics) != 2 {
+			return change, fmt.Errorf("beacon upgraded with %d topics", len(l.Topics))
+		}
+		change.Kind = models.ProxyBeaconUpgraded
+		change.Address = common.BytesToAddress(l.Topics[1].Bytes()).Hex()
+		slot = beaconSlot
+	case proxyABI.Events["AdminChanged"].ID:
+		out, err := proxyABI.Unpack("AdminChanged", l.Data)
+		if err != nil {
+			return change, err
+		}
+		change.Kind = models.ProxyAdminChanged
+		change.Previous = out[0].(common.Address).Hex()
+		change.Address = out[1].(common.Address).Hex()
+		slot = adminSlot
+	default:
+		return change, fmt.Errorf("unknown topic %s", l.Topics[0].Hex())
+	}
+	block := new(big.Int).SetUint64(l.BlockNumber)
+	if stored, err := readSlotAddress(rs.client, rs.vault, slot, block); err == nil {
+		change.SlotVerified = stored.Hex() == change.Address
+	}
+	if header, err := rs.headerByNumber(l.BlockNumber); err == nil {
+		change.BlockTime = int64(header.Time)
+	}
+	return change, nil
+}
+
+// ImplementationHistory returns the recorded proxy changes for the vault, oldest first.
+func (rs *RateService) ImplementationHistory() ([]models.ImplementationChange, error) {
+	if rs.cache == nil {
+		return nil, ErrNoCache
+	}
+	return rs.cache.GetImplementationHistory(rs.info.ID)
+}
+
+// noteImplementation publishes a live upgrade alert when a snapshot sees a new implementation.
+func (rs *RateService) noteImplementation(update models.RateUpdate) {
+	if update.Implementation == "" {
+		return
+	}
+	rs.implMu.Lock()
+	previous := rs.lastImpl
+	rs.lastImpl = update.Implementation
+	rs.implMu.Unlock()
+	if previous == "" || previous == update.Implementation {
+		return
+	}
+	log.Printf("[Proxy] %s implementation changed %s -> %s at block %d", rs.info.ID, previous, update.Implementation, update.BlockNumber)
+	rs.events.Publish(models.Event{
+		Type:    models.EventUpgrade,
+		VaultID: rs.info.ID,
+		Data: models.ImplementationChange{
+			Kind:         models.ProxyUpgraded,
+			Address:      update.Implementation,
+			Previous:     previous,
+			BlockNumber:  update.BlockNumber,
+			BlockTime:    update.BlockTime,
+			SlotVerified: true,
+		},
+	})
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/Zarathos94/puffer/events"
+	"github.com/Zarathos94/puffer/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// proxyLog builds a proxy event log at block.
+func proxyLog(t *testing.T, block uint64, event string, topics []common.Hash, args ...interface{}) types.Log {
+	t.Helper()
+	ev := proxyABI.Events[event]
+	data, err := ev.Inputs.NonIndexed().Pack(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.Log{Address: testVault, Topics: append([]common.Hash{ev.ID}, topics...), Data: data, BlockNumber: block}
+}
+
+func TestUpgradesAreAnnouncedOnce(t *testing.T) {
+	chain := newFakeChain(100, 1_700_000_000, 12)
+	rs := newChainService(t, chain)
+	rs.cache = newTestService(t).cache
+	bus := events.NewBus()
+	rs.SetEventBus(bus)
+	ch, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+	if err := rs.cache.SetUpgradeCursor("v", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	oldImpl := common.HexToAddress("0x3000000000000000000000000000000000000001")
+	newImpl := common.HexToAddress("0x3000000000000000000000000000000000000002")
+	admin := common.HexToAddress("0x3000000000000000000000000000000000000003")
+	// The live path announces the upgrade as soon as a snapshot sees it
+	rs.noteImplementation(models.RateUpdate{Implementation: oldImpl.Hex(), BlockNumber: 40})
+	rs.noteImplementation(models.RateUpdate{Implementation: newImpl.Hex(), BlockNumber: 52})
+	chain.logs = []types.Log{
+		proxyLog(t, 50, "Upgraded", []common.Hash{common.BytesToHash(newImpl.Bytes())}),
+		proxyLog(t, 60, "AdminChanged", nil, common.Address{}, admin),
+	}
+	if err := rs.IndexUpgrades(); err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	for len(ch) > 0 {
+		e := <-ch
+		kinds = append(kinds, e.Data.(models.ImplementationChange).Kind)
+	}
+	if len(kinds) != 2 || kinds[0] != models.ProxyUpgraded || kinds[1] != models.ProxyAdminChanged {
+		t.Fatalf("published %v, want the live upgrade then the admin change", kinds)
+	}
+	history, err := rs.ImplementationHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("recorded %d changes, want both", len(history))
+	}
+}
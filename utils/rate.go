@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+const (
+	// DefaultRatePrecision is the number of decimals used for rate_decimal.
+	DefaultRatePrecision = 18
+	// MaxRatePrecision caps the precision parameter accepted by the API.
+	MaxRatePrecision = 36
+	// RateMismatchToleranceBps is how far convertToAssets may drift from
+	// totalAssets/totalSupply, or from the inverse of convertToShares, before a
+	// snapshot is flagged.
+	RateMismatchToleranceBps = 1
+)
+
+// oneShare is 1e18, the unit passed to convertToAssets and convertToShares.
+var oneShare = new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+// NewRateUpdate builds a RateUpdate from exact totalAssets and totalSupply values.
+func NewRateUpdate(ts int64, assets, supply *big.Int) models.RateUpdate {
+	var rate float64
+	if supply.Sign() > 0 {
+		fAssets := new(big.Float).SetInt(assets)
+		fSupply := new(big.Float).SetInt(supply)
+		fRate := new(big.Float).Quo(fAssets, fSupply)
+		rate, _ = fRate.Float64()
+	}
+	update := models.RateUpdate{
+		Timestamp:      ts,
+		Rate:           rate,
+		Assets:         FormatETH(assets),
+		TotalSupply:    FormatETH(supply),
+		AssetsWei:      assets.String(),
+		TotalSupplyWei: supply.String(),
+	}
+	if r := ratioRate(assets, supply); r != nil {
+		update.RateDecimal = r.FloatString(DefaultRatePrecision)
+	}
+	return update
+}
+
+// ApplyConversions records the vault's own convertToAssets(1e18) and
+// convertToShares(1e18) answers. It flags a mismatch when convertToAssets
+// disagrees with the raw ratio or convertToShares isn't its inverse, and
+// records the larger of the two divergences.
+func ApplyConversions(update *models.RateUpdate, assetsPerShare, sharesPerAsset *big.Int) {
+	update.AssetsPerShare = assetsPerShare.String()
+	update.SharesPerAsset = sharesPerAsset.String()
+	onChain := new(big.Rat).SetFrac(assetsPerShare, oneShare)
+	update.RateDecimal = onChain.FloatString(DefaultRatePrecision)
+
+	var worst *big.Rat
+	if sharesPerAsset.Sign() > 0 {
+		// Round trip: 1e18 shares -> assets -> shares should come back as 1e18
+		roundTrip := new(big.Rat).SetFrac(new(big.Int).Mul(assetsPerShare, sharesPerAsset), new(big.Int).Mul(oneShare, oneShare))
+		worst = divergenceBps(roundTrip, big.NewRat(1, 1))
+	}
+	assets, okA := new(big.Int).SetString(update.AssetsWei, 10)
+	supply, okS := new(big.Int).SetString(update.TotalSupplyWei, 10)
+	if okA && okS {
+		if ratio := ratioRate(assets, supply); ratio != nil && ratio.Sign() != 0 {
+			if bps := divergenceBps(onChain, ratio); worst == nil || bps.Cmp(worst) > 0 {
+				worst = bps
+			}
+		}
+	}
+	if worst == nil {
+		return
+	}
+	update.RateDivergenceBps, _ = worst.Float64()
+	update.RateMismatch = worst.Cmp(big.NewRat(RateMismatchToleranceBps, 1)) > 0
+}
+
+// divergenceBps returns |got - want| / want in basis points.
+func divergenceBps(got, want *big.Rat) *big.Rat {
+	diff := new(big.Rat).Sub(got, want)
+	diff.Abs(diff)
+	bps := new(big.Rat).Quo(diff, want)
+	return bps.Mul(bps, big.NewRat(10000, 1))
+}
+
+// RateDecimal renders a snapshot's exact rate with the requested number of decimals.
+// It prefers convertToAssets(1e18) and falls back to totalAssets/totalSupply.
+func RateDecimal(update models.RateUpdate, precision int) (string, error) {
+	if precision < 0 || precision > MaxRatePrecision {
+		return "", fmt.Errorf("precision must be between 0 and %d", MaxRatePrecision)
+	}
+	if perShare, ok := new(big.Int).SetString(update.AssetsPerShare, 10); ok {
+		return new(big.Rat).SetFrac(perShare, oneShare).FloatString(precision), nil
+	}
+	assets, okA := new(big.Int).SetString(update.AssetsWei, 10)
+	supply, okS := new(big.Int).SetString(update.TotalSupplyWei, 10)
+	if !okA || !okS {
+		return "", fmt.Errorf("snapshot has no exact values")
+	}
+	r := ratioRate(assets, supply)
+	if r == nil {
+		return new(big.Rat).FloatString(precision), nil
+	}
+	return r.FloatString(precision), nil
+}
+
+// ratioRate returns totalAssets/totalSupply exactly, or nil when supply is zero.
+func ratioRate(assets, supply *big.Int) *big.Rat {
+	if supply.Sign() <= 0 {
+		return nil
+	}
+	return new(big.Rat).SetFrac(assets, supply)
+}
@@ -2,17 +2,19 @@ package utils
 
 import (
 	"context"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
-	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Zarathos94/puffer/cache"
+	"github.com/Zarathos94/puffer/etherscanclient"
+	"github.com/Zarathos94/puffer/events"
 	"github.com/Zarathos94/puffer/models"
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -46,22 +48,68 @@ func FormatETH(val *big.Int) string {
 	}
 }
 
+// abiJSON covers the ERC-4626 view methods and events read from every tracked vault.
 const (
-	vaultAddress = "0xD9A442856C234a39a81a089C06451EBAa4306a72"
-	abiJSON      = `[ { "inputs": [], "name": "totalAssets", "outputs": [ { "internalType": "uint256", "name": "", "type": "uint256" } ], "stateMutability": "view", "type": "function" }, { "inputs": [], "name": "totalSupply", "outputs": [ { "internalType": "uint256", "name": "", "type": "uint256" } ], "stateMutability": "view", "type": "function" } ]`
+	abiJSON = `[ { "inputs": [], "name": "totalAssets", "outputs": [ { "internalType": "uint256", "name": "", "type": "uint256" } ], "stateMutability": "view", "type": "function" }, { "inputs": [], "name": "totalSupply", "outputs": [ { "internalType": "uint256", "name": "", "type": "uint256" } ], "stateMutability": "view", "type": "function" }, { "inputs": [ { "internalType": "uint256", "name": "shares", "type": "uint256" } ], "name": "convertToAssets", "outputs": [ { "internalType": "uint256", "name": "", "type": "uint256" } ], "stateMutability": "view", "type": "function" }, { "inputs": [ { "internalType": "uint256", "name": "assets", "type": "uint256" } ], "name": "convertToShares", "outputs": [ { "internalType": "uint256", "name": "", "type": "uint256" } ], "stateMutability": "view", "type": "function" }, { "anonymous": false, "inputs": [ { "indexed": true, "internalType": "address", "name": "from", "type": "address" }, { "indexed": true, "internalType": "address", "name": "to", "type": "address" }, { "indexed": false, "internalType": "uint256", "name": "value", "type": "uint256" } ], "name": "Transfer", "type": "event" }, { "anonymous": false, "inputs": [ { "indexed": true, "internalType": "address", "name": "sender", "type": "address" }, { "indexed": true, "internalType": "address", "name": "owner", "type": "address" }, { "indexed": false, "internalType": "uint256", "name": "assets", "type": "uint256" }, { "indexed": false, "internalType": "uint256", "name": "shares", "type": "uint256" } ], "name": "Deposit", "type": "event" }, { "anonymous": false, "inputs": [ { "indexed": true, "internalType": "address", "name": "sender", "type": "address" }, { "indexed": true, "internalType": "address", "name": "receiver", "type": "address" }, { "indexed": true, "internalType": "address", "name": "owner", "type": "address" }, { "indexed": false, "internalType": "uint256", "name": "assets", "type": "uint256" }, { "indexed": false, "internalType": "uint256", "name": "shares", "type": "uint256" } ], "name": "Withdraw", "type": "event" } ]`
 )
 
+// EthClient is the set of RPC methods the rate service uses.
+// Both *ethclient.Client and *rpcpool.Pool satisfy it.
+type EthClient interface {
+	ContractCaller
+	HeaderReader
+	LogFilterer
+	BlockNumber(ctx context.Context) (uint64, error)
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+}
+
+// ErrNoCache is returned by features that keep their state in Redis when the
+// service runs without it.
+var ErrNoCache = errors.New("this feature needs Redis (set REDIS_ADDR)")
+
 type RateService struct {
-	client    *ethclient.Client
+	client    EthClient
 	parsedABI abi.ABI
+	info      models.Vault
 	vault     common.Address
-	cache     *cache.Cache
-}
+	// cache holds everything but rates and history: raw points, rollups, gaps,
+	// alerts, checkpoints and pub/sub. It is nil without Redis, which turns
+	// those features off.
+	cache *cache.Cache
+	// store holds the latest rate and history.
+	store     cache.RateStore
+	batcher   *Batcher
+	events    *events.Bus
+	resolver  BlockResolver
+	etherscan *etherscanclient.Client
+	// confirmations is how many blocks deep a snapshot must be before it is confirmed.
+	confirmations uint64
+	// retention is how long history points are kept; zero keeps them forever.
+	retention time.Duration
 
-// ERC1967 implementation slot
-var implSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	backfillMu  sync.Mutex
+	backfilling bool
+	// backfillOwner identifies this process's Redis lease on the running backfill.
+	backfillOwner string
+	deployBlock   uint64
+
+	upgradeMu sync.Mutex
+	implMu    sync.Mutex
+	lastImpl  string
+
+	detector *Detector
+	rollups  RollupConfig
+
+	apyMu         sync.Mutex
+	apyCache      []models.APY
+	apyAt         time.Time
+	apyRefreshing bool
+	// edgeReads memoizes confirmed window-start snapshots by block.
+	edgeMu    sync.Mutex
+	edgeReads map[uint64]models.RateUpdate
+}
 
-func NewRateService(ethURL string) (*RateService, error) {
+func NewRateService(ethURL string, info models.Vault) (*RateService, error) {
 	client, err := ethclient.Dial(ethURL)
 	if err != nil {
 		return nil, err
@@ -70,355 +118,287 @@ func NewRateService(ethURL string) (*RateService, error) {
 	if err != nil {
 		return nil, err
 	}
-	vault := common.HexToAddress(vaultAddress)
 	return &RateService{
 		client:    client,
 		parsedABI: parsedABI,
-		vault:     vault,
+		info:      info,
+		vault:     common.HexToAddress(info.Address),
+		store:     cache.NewMemoryStore(),
+		batcher:   NewBatcher(client),
+		resolver:  NewRPCBlockResolver(client),
+		detector:  NewDetector(DefaultAnomalyConfig),
+		rollups:   DefaultRollupConfig,
 	}, nil
 }
 
-func NewRateServiceWithCache(ethURL string, c *cache.Cache) (*RateService, error) {
-	client, err := ethclient.Dial(ethURL)
-	if err != nil {
-		return nil, err
-	}
+// NewRateServiceWithCache builds a service over an existing client, typically an rpcpool.Pool.
+func NewRateServiceWithCache(client EthClient, info models.Vault, c *cache.Cache) (*RateService, error) {
+	return NewRateServiceWithStore(client, info, c, c)
+}
+
+// NewRateServiceWithStore is NewRateServiceWithCache with rates kept in store
+// instead of Redis. c may be nil, see ErrNoCache.
+func NewRateServiceWithStore(client EthClient, info models.Vault, c *cache.Cache, store cache.RateStore) (*RateService, error) {
 	parsedABI, err := abi.JSON(strings.NewReader(abiJSON))
 	if err != nil {
 		return nil, err
 	}
-	vault := common.HexToAddress(vaultAddress)
-	rs := &RateService{
+	return &RateService{
 		client:    client,
 		parsedABI: parsedABI,
-		vault:     vault,
+		info:      info,
+		vault:     common.HexToAddress(info.Address),
 		cache:     c,
-	}
-	// Start event log backfill in background
-	go rs.EventLogBackfillLast24Hours()
-	log.Printf("[EventLogBackfill] Started background event log backfill goroutine")
-	return rs, nil
+		store:     store,
+		batcher:   NewBatcher(client),
+		resolver:  NewRPCBlockResolver(client),
+		detector:  NewDetector(DefaultAnomalyConfig),
+		rollups:   DefaultRollupConfig,
+	}, nil
 }
 
 func (rs *RateService) FetchAndUpdate() {
-	assets, err := callBigInt(rs.client, rs.parsedABI, rs.vault, "totalAssets")
-	if err != nil {
-		log.Printf("Error calling totalAssets: %v", err)
-		return
-	}
-	supply, err := callBigInt(rs.client, rs.parsedABI, rs.vault, "totalSupply")
+	// Pin every read of this snapshot to one block so the ratio is consistent
+	header, err := rs.latestHeader()
 	if err != nil {
-		log.Printf("Error calling totalSupply: %v", err)
+		log.Printf("Error fetching latest block for %s: %v", rs.info.ID, err)
 		return
 	}
-	var rate float64
-	if supply.Cmp(big.NewInt(0)) > 0 {
-		fAssets := new(big.Float).SetInt(assets)
-		fSupply := new(big.Float).SetInt(supply)
-		fRate := new(big.Float).Quo(fAssets, fSupply)
-		rate, _ = fRate.Float64()
-	}
+	rs.FetchAndUpdateAt(header)
+}
+
+// FetchAndUpdateAt snapshots the vault at the given block header.
+func (rs *RateService) FetchAndUpdateAt(header *types.Header) {
 	ts := time.Now().Unix()
 	hourTs := ts - (ts % 3600)
-	update := models.RateUpdate{
-		Timestamp:   hourTs,
-		Rate:        rate,
-		Assets:      FormatETH(assets),
-		TotalSupply: FormatETH(supply),
+	update, err := rs.snapshotAt(header, hourTs)
+	if err != nil {
+		log.Printf("Error reading vault state for %s at block %s: %v", rs.info.ID, header.Number, err)
+		return
 	}
-	if err := rs.cache.SetLatestRate(update); err != nil {
+	update.Status = rs.statusFor(update.BlockNumber, header.Number.Uint64())
+	rs.noteImplementation(update)
+	rs.detectAnomalies(update)
+	if err := rs.store.SetLatestRate(rs.info.ID, update); err != nil {
 		log.Printf("Error caching latest rate: %v", err)
 	}
-	if err := rs.cache.AddHistoricalRate(update); err != nil {
+	rs.publishRate(update)
+	if rs.cache != nil {
+		raw := update
+		raw.Timestamp = ts
+		if err := rs.cache.AddRawRate(rs.info.ID, raw); err != nil {
+			log.Printf("Error caching raw rate: %v", err)
+		}
+	}
+	if err := rs.store.AddHistoricalRate(rs.info.ID, update); err != nil {
 		log.Printf("Error caching historical rate: %v", err)
 	}
-	cutoff := time.Now().Add(-24 * time.Hour).Unix()
-	if err := rs.cache.CleanupOldRates(cutoff); err != nil {
+	if err := rs.PruneHistory(); err != nil {
 		log.Printf("Error cleaning up old rates: %v", err)
 	}
+	rs.CheckReorgs(header.Number.Uint64())
+}
+
+// publishRate announces a new latest rate on the event bus and, with Redis, to
+// every replica's SSE clients.
+func (rs *RateService) publishRate(update models.RateUpdate) {
+	rs.events.Publish(models.Event{Type: models.EventRate, VaultID: rs.info.ID, Data: update})
+	if rs.cache != nil {
+		if err := rs.cache.PublishRate(rs.info.ID, update); err != nil {
+			log.Printf("Error publishing latest rate: %v", err)
+		}
+	}
+}
+
+// snapshotAt reads the vault at header and builds a RateUpdate stamped with ts.
+func (rs *RateService) snapshotAt(header *types.Header, ts int64) (models.RateUpdate, error) {
+	state, err := rs.readState(header.Number)
+	if err != nil {
+		return models.RateUpdate{}, err
+	}
+	update := NewRateUpdate(ts, state.assets, state.supply)
+	ApplyConversions(&update, state.assetsPerShare, state.sharesPerAsset)
+	if update.RateMismatch {
+		log.Printf("Rate mismatch for %s at block %s: convertToAssets diverges from totalAssets/totalSupply by %.4f bps", rs.info.ID, header.Number, update.RateDivergenceBps)
+	}
+	update.BlockNumber = header.Number.Uint64()
+	update.BlockHash = header.Hash().Hex()
+	update.BlockTime = int64(header.Time)
+	if impl, err := GetImplementationAddressAtBlock(rs.client, rs.vault, header.Number); err == nil && impl != (common.Address{}) {
+		update.Implementation = impl.Hex()
+	}
+	return update, nil
 }
 
 func (rs *RateService) GetLatest() (models.RateUpdate, error) {
-	return rs.cache.GetLatestRate()
+	return rs.store.GetLatestRate(rs.info.ID)
 }
 
 func (rs *RateService) GetHistory(from, to int64) ([]models.RateUpdate, error) {
-	return rs.cache.GetHistoricalRates(from, to)
+	return rs.store.GetHistoricalRates(rs.info.ID, from, to)
 }
 
-func callBigInt(client *ethclient.Client, parsedABI abi.ABI, contract common.Address, method string) (*big.Int, error) {
-	data, err := parsedABI.Pack(method)
-	if err != nil {
-		return nil, err
-	}
-	callMsg := ethereum.CallMsg{
-		To:   &contract,
-		Data: data,
-	}
+// latestHeader resolves the current head that a snapshot is pinned to.
+func (rs *RateService) latestHeader() (*types.Header, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return rs.client.HeaderByNumber(ctx, nil)
+}
+
+// vaultState is one consistent read of the vault's view methods at a single block.
+type vaultState struct {
+	assets         *big.Int
+	supply         *big.Int
+	assetsPerShare *big.Int
+	sharesPerAsset *big.Int
+}
+
+// readState batches every view call for a block into one Multicall3 request.
+func (rs *RateService) readState(block *big.Int) (vaultState, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	res, err := client.CallContract(ctx, callMsg, nil)
+	calls := []Call{
+		{Target: rs.vault, ABI: rs.parsedABI, Method: "totalAssets"},
+		{Target: rs.vault, ABI: rs.parsedABI, Method: "totalSupply"},
+		{Target: rs.vault, ABI: rs.parsedABI, Method: "convertToAssets", Args: []interface{}{oneShare}},
+		{Target: rs.vault, ABI: rs.parsedABI, Method: "convertToShares", Args: []interface{}{oneShare}},
+	}
+	results, err := rs.batcher.Call(ctx, block, calls)
 	if err != nil {
-		return nil, err
+		return vaultState{}, err
+	}
+	values := make([]*big.Int, len(results))
+	for i, r := range results {
+		v, err := r.BigInt()
+		if err != nil {
+			return vaultState{}, fmt.Errorf("%s: %w", calls[i].Method, err)
+		}
+		values[i] = v
 	}
-	out := new(big.Int)
-	parsedABI.UnpackIntoInterface(&out, method, res)
-	return out, nil
+	return vaultState{
+		assets:         values[0],
+		supply:         values[1],
+		assetsPerShare: values[2],
+		sharesPerAsset: values[3],
+	}, nil
 }
 
 func (rs *RateService) UpdateHourlyHistorical() {
 	now := time.Now()
 	hourStart := now.Truncate(time.Hour).Unix()
 	// Check if this hour's historical value is already in cache
-	history, err := rs.cache.GetHistoricalRates(hourStart, hourStart)
+	history, err := rs.store.GetHistoricalRates(rs.info.ID, hourStart, hourStart)
 	if err == nil && len(history) > 0 {
 		// Already cached for this hour
 		return
 	}
-	// Fetch block number for hourStart from Etherscan
-	blockNum, err := GetBlockNumberByTimestamp(hourStart)
-	if err != nil {
-		log.Printf("[HourlyHistorical] Failed to get block number for %d: %v", hourStart, err)
-		return
-	}
-	assetsData, _ := rs.parsedABI.Pack("totalAssets")
-	supplyData, _ := rs.parsedABI.Pack("totalSupply")
-	assetsHex := "0x" + hex.EncodeToString(assetsData)
-	supplyHex := "0x" + hex.EncodeToString(supplyData)
-	assetsRes, err := CallContractAtBlock(rs.vault.Hex(), assetsHex, blockNum)
-	if err != nil || len(assetsRes) < 3 {
-		log.Printf("[HourlyHistorical] Failed to get totalAssets for block=%s: %v", blockNum, err)
+	if err := rs.RecordHour(hourStart); err != nil {
+		log.Printf("[HourlyHistorical] Failed to record hour=%d for %s: %v", hourStart, rs.info.ID, err)
 		return
 	}
-	supplyRes, err := CallContractAtBlock(rs.vault.Hex(), supplyHex, blockNum)
-	if err != nil || len(supplyRes) < 3 {
-		log.Printf("[HourlyHistorical] Failed to get totalSupply for block=%s: %v", blockNum, err)
-		return
-	}
-	assets := new(big.Int)
-	supply := new(big.Int)
-	assets.SetString(assetsRes[2:], 16)
-	supply.SetString(supplyRes[2:], 16)
-	var rate float64
-	if supply.Cmp(big.NewInt(0)) > 0 {
-		fAssets := new(big.Float).SetInt(assets)
-		fSupply := new(big.Float).SetInt(supply)
-		fRate := new(big.Float).Quo(fAssets, fSupply)
-		rate, _ = fRate.Float64()
-	}
-	update := models.RateUpdate{
-		Timestamp:   hourStart,
-		Rate:        rate,
-		Assets:      FormatETH(assets),
-		TotalSupply: FormatETH(supply),
-	}
-	if err := rs.cache.AddHistoricalRate(update); err != nil {
-		log.Printf("[HourlyHistorical] Failed to add historical rate for hour=%d: %v", hourStart, err)
-	} else {
-		log.Printf("[HourlyHistorical] Added historical rate for hour=%d", hourStart)
-	}
-}
-
-// Add exported getters for main.go access
-func (rs *RateService) ParsedABI() abi.ABI {
-	return rs.parsedABI
-}
-
-func (rs *RateService) Vault() common.Address {
-	return rs.vault
-}
-
-func (rs *RateService) Cache() *cache.Cache {
-	return rs.cache
+	log.Printf("[HourlyHistorical] Added historical rate for hour=%d", hourStart)
 }
 
-// GetImplementationAddressAtBlock resolves the implementation address for a proxy at a given block
-func GetImplementationAddressAtBlock(client *ethclient.Client, proxy common.Address, blockNum *big.Int) (common.Address, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// RecordHour reads the vault at the last block mined in the hour starting at
+// hourStart and stores it as that hour's point, the hour's closing state. The
+// closing block is at least as high as every live snapshot taken during the
+// hour, so the block-number last-writer-wins rule keeps this read; a read from
+// before the hour started would always lose to them.
+func (rs *RateService) RecordHour(hourStart int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	data, err := client.StorageAt(ctx, proxy, implSlot, blockNum)
+	blockNum, err := rs.resolver.BlockAtTime(ctx, hourStart+3599)
 	if err != nil {
-		return common.Address{}, err
+		return fmt.Errorf("resolve block: %w", err)
 	}
-	if len(data) < 32 {
-		return common.Address{}, fmt.Errorf("invalid storage data")
-	}
-	return common.BytesToAddress(data[12:]), nil // last 20 bytes
-}
-
-// FetchHistoricalValueAtBlockProxy calls the implementation contract at a given block for a proxy
-func FetchHistoricalValueAtBlockProxy(client *ethclient.Client, proxy common.Address, abi abi.ABI, method string, blockNum *big.Int) *big.Int {
-	implAddr, err := GetImplementationAddressAtBlock(client, proxy, blockNum)
+	header, err := rs.headerByNumber(blockNum)
 	if err != nil {
-		log.Printf("[Proxy] Failed to resolve implementation at block %d: %v", blockNum.Int64(), err)
-		return nil
+		return fmt.Errorf("header %d: %w", blockNum, err)
 	}
-	data, _ := abi.Pack(method)
-	res, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &implAddr, Data: data}, blockNum)
+	update, err := rs.snapshotAt(header, hourStart)
 	if err != nil {
-		log.Printf("[Proxy] eth_call error: %v", err)
-		return nil
+		return fmt.Errorf("read state at %d: %w", blockNum, err)
 	}
-	var out []interface{}
-	err = abi.UnpackIntoInterface(&out, method, res)
-	if err != nil {
-		log.Printf("[Proxy] unpack error: %v", err)
-		return nil
+	// Like live snapshots, a point within the confirmation depth stays pending
+	// until CheckReorgs confirms it. Without a head, assume it is not final yet.
+	head := blockNum
+	if latest, err := rs.latestHeader(); err == nil {
+		head = latest.Number.Uint64()
 	}
-	if len(out) > 0 {
-		if v, ok := out[0].(*big.Int); ok {
-			return v
-		}
-		if v, ok := out[0].(big.Int); ok {
-			return &v
+	update.Status = rs.statusFor(update.BlockNumber, head)
+	if err := rs.store.AddHistoricalRate(rs.info.ID, update); err != nil {
+		return err
+	}
+	if rs.cache != nil {
+		if err := rs.cache.RemoveHistoryGap(rs.info.ID, hourStart); err != nil {
+			log.Printf("[HourlyHistorical] Failed to clear gap hour=%d for %s: %v", hourStart, rs.info.ID, err)
 		}
 	}
 	return nil
 }
 
-// EventLogBackfillLast24Hours reconstructs and caches the last 24 hours of totalSupply/totalAssets using event logs
-func (rs *RateService) EventLogBackfillLast24Hours() {
-	log.Printf("[EventLogBackfill] Starting EventLogBackfillLast24Hours")
-	now := time.Now().Truncate(time.Hour)
-
-	// Get the latest block number
-	latestHeader, err := rs.client.HeaderByNumber(context.Background(), nil)
-	if err != nil {
-		log.Printf("[EventLogBackfill] Failed to get latest block: %v", err)
-		return
+// RecordGap notes that hourStart could not be recorded and why. Without Redis
+// gaps are only logged by the caller.
+func (rs *RateService) RecordGap(hourStart int64, reason error) error {
+	if rs.cache == nil {
+		return nil
 	}
-	latestBlock := latestHeader.Number.Int64()
-	fromBlockInt := latestBlock - 1000
-	if fromBlockInt < 0 {
-		fromBlockInt = 0
+	return rs.cache.AddHistoryGap(rs.info.ID, models.HistoryGap{
+		Hour:       hourStart,
+		Reason:     reason.Error(),
+		RecordedAt: time.Now().Unix(),
+	})
+}
+
+// Gaps returns the hours in [from, to] that were skipped and not filled since.
+func (rs *RateService) Gaps(from, to int64) ([]models.HistoryGap, error) {
+	if rs.cache == nil {
+		return nil, ErrNoCache
 	}
-	toBlockInt := latestBlock
-	log.Printf("[EventLogBackfill] Limiting block range to %d - %d", fromBlockInt, toBlockInt)
+	return rs.cache.GetHistoryGaps(rs.info.ID, from, to)
+}
 
-	transferSig := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+// SetHistoryRetention sets how long history points are kept. Zero keeps them forever.
+func (rs *RateService) SetHistoryRetention(d time.Duration) {
+	rs.retention = d
+}
 
-	query := ethereum.FilterQuery{
-		FromBlock: big.NewInt(fromBlockInt),
-		ToBlock:   big.NewInt(toBlockInt),
-		Addresses: []common.Address{rs.vault},
+// PruneHistory drops history points older than the retention window.
+func (rs *RateService) PruneHistory() error {
+	if rs.retention <= 0 {
+		return nil
 	}
-	logs, err := rs.client.FilterLogs(context.Background(), query)
+	return rs.store.CleanupOldRates(rs.info.ID, time.Now().Add(-rs.retention).Unix())
+}
+
+// SetBlockResolver replaces the default RPC block resolver.
+func (rs *RateService) SetBlockResolver(r BlockResolver) {
+	rs.resolver = r
+}
+
+// ParseBlockNumber parses a decimal or 0x-prefixed block number, returning 0 if it is malformed.
+func ParseBlockNumber(s string) uint64 {
+	n, err := strconv.ParseUint(s, 0, 64)
 	if err != nil {
-		log.Printf("[EventLogBackfill] Failed to fetch logs: %v", err)
-		return
+		return 0
 	}
-	log.Printf("[EventLogBackfill] FilterLogs returned %d logs", len(logs))
-
-	// Pre-fetch all unique block timestamps
-	blockTimeMap := make(map[uint64]int64)
-	for _, l := range logs {
-		if _, ok := blockTimeMap[l.BlockNumber]; !ok {
-			block, err := rs.client.BlockByNumber(context.Background(), big.NewInt(int64(l.BlockNumber)))
-			if err != nil {
-				log.Printf("[EventLogBackfill] Failed to fetch block %d: %v", l.BlockNumber, err)
-				continue
-			}
-			blockTimeMap[l.BlockNumber] = int64(block.Time())
-			if len(blockTimeMap)%10 == 0 {
-				log.Printf("[EventLogBackfill] Prefetched %d blocks so far...", len(blockTimeMap))
-			}
-		}
-	}
-	log.Printf("[EventLogBackfill] Prefetched %d unique block timestamps", len(blockTimeMap))
+	return n
+}
 
-	// Sort logs by block time ascending
-	type logWithTime struct {
-		log  types.Log
-		time int64
-	}
-	var logsWithTime []logWithTime
-	for _, l := range logs {
-		if t, ok := blockTimeMap[l.BlockNumber]; ok {
-			logsWithTime = append(logsWithTime, logWithTime{l, t})
-		}
-	}
-	// Sort
-	sort.Slice(logsWithTime, func(i, j int) bool { return logsWithTime[i].time < logsWithTime[j].time })
-
-	// Start with the current state (at 'now')
-	assets, _ := callBigInt(rs.client, rs.parsedABI, rs.vault, "totalAssets")
-	supply, _ := callBigInt(rs.client, rs.parsedABI, rs.vault, "totalSupply")
-	log.Printf("[EventLogBackfill] Got current state: Assets=%s, Supply=%s", assets.String(), supply.String())
-	currentAssets := new(big.Int).Set(assets)
-	currentSupply := new(big.Int).Set(supply)
-
-	isZero := func(addr common.Address) bool {
-		return addr == common.Address{}
-	}
+// Add exported getters for main.go access
+func (rs *RateService) ParsedABI() abi.ABI {
+	return rs.parsedABI
+}
 
-	hourly := make(map[int64]struct {
-		Assets *big.Int
-		Supply *big.Int
-	})
+func (rs *RateService) Vault() common.Address {
+	return rs.vault
+}
 
-	// Walk logs backwards (from newest to oldest)
-	lastHour := now.Unix()
-	for i := len(logsWithTime) - 1; i >= 0; i-- {
-		l := logsWithTime[i]
-		logHour := l.time - (l.time % 3600)
-		// Fill in all hours between lastHour and logHour
-		for h := lastHour; h > logHour; h -= 3600 {
-			hourly[h] = struct {
-				Assets *big.Int
-				Supply *big.Int
-			}{new(big.Int).Set(currentAssets), new(big.Int).Set(currentSupply)}
-			log.Printf("[EventLogBackfill] Writing hour=%d, Assets=%s, Supply=%s", h, currentAssets.String(), currentSupply.String())
-		}
-		lastHour = logHour
-		// Apply event (reverse, since we're going backwards)
-		if l.log.Topics[0] == transferSig && len(l.log.Topics) == 3 {
-			fromAddr := common.BytesToAddress(l.log.Topics[1].Bytes())
-			toAddr := common.BytesToAddress(l.log.Topics[2].Bytes())
-			amount := new(big.Int).SetBytes(l.log.Data)
-			if isZero(fromAddr) {
-				// Mint: reverse by subtracting
-				currentSupply.Sub(currentSupply, amount)
-				currentAssets.Sub(currentAssets, amount)
-			} else if isZero(toAddr) {
-				// Burn: reverse by adding
-				currentSupply.Add(currentSupply, amount)
-				currentAssets.Add(currentAssets, amount)
-			}
-		}
-	}
-	// Fill in any remaining hours
-	for h := lastHour; h > now.Add(-24*time.Hour).Unix(); h -= 3600 {
-		hourly[h] = struct {
-			Assets *big.Int
-			Supply *big.Int
-		}{new(big.Int).Set(currentAssets), new(big.Int).Set(currentSupply)}
-		log.Printf("[EventLogBackfill] Writing hour=%d, Assets=%s, Supply=%s", h, currentAssets.String(), currentSupply.String())
-	}
+// Info returns the registry entry for the vault this service tracks.
+func (rs *RateService) Info() models.Vault {
+	return rs.info
+}
 
-	// Insert into cache
-	count := 0
-	for h, v := range hourly {
-		var rate float64
-		if v.Supply.Cmp(big.NewInt(0)) > 0 {
-			fAssets := new(big.Float).SetInt(v.Assets)
-			fSupply := new(big.Float).SetInt(v.Supply)
-			fRate := new(big.Float).Quo(fAssets, fSupply)
-			rate, _ = fRate.Float64()
-		}
-		update := models.RateUpdate{
-			Timestamp:   h,
-			Rate:        rate,
-			Assets:      FormatETH(v.Assets),
-			TotalSupply: FormatETH(v.Supply),
-		}
-		err := rs.Cache().AddHistoricalRate(update)
-		if err != nil {
-			log.Printf("[EventLogBackfill] AddHistoricalRate error for hour=%d: %v", h, err)
-		} else {
-			count++
-		}
-	}
-	log.Printf("[EventLogBackfill] Inserted %d hourly points", count)
-	cutoff := now.Add(-24 * time.Hour).Unix()
-	rs.Cache().CleanupOldRates(cutoff)
+func (rs *RateService) Cache() *cache.Cache {
+	return rs.cache
 }
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestApplyConversions(t *testing.T) {
+	e18 := func(s string) *big.Int {
+		v, _ := new(big.Int).SetString(s, 10)
+		return v
+	}
+	tests := []struct {
+		name           string
+		assetsPerShare string
+		sharesPerAsset string
+		wantMismatch   bool
+		wantBps        float64
+	}{
+		{"consistent", "1050000000000000000", "952380952380952380", false, 0},
+		{"shares not the inverse", "1050000000000000000", "940000000000000000", true, 130},
+		{"no shares answer", "1050000000000000000", "0", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// totalAssets/totalSupply agrees with convertToAssets exactly
+			update := NewRateUpdate(0, e18("1050000000000000000000"), e18("1000000000000000000000"))
+			ApplyConversions(&update, e18(tt.assetsPerShare), e18(tt.sharesPerAsset))
+			if update.RateMismatch != tt.wantMismatch {
+				t.Fatalf("RateMismatch = %v (%.4f bps), want %v", update.RateMismatch, update.RateDivergenceBps, tt.wantMismatch)
+			}
+			if d := update.RateDivergenceBps - tt.wantBps; d > 0.5 || d < -0.5 {
+				t.Fatalf("RateDivergenceBps = %.4f, want about %.0f", update.RateDivergenceBps, tt.wantBps)
+			}
+		})
+	}
+}
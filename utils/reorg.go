@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/Zarathos94/puffer/events"
+	"github.com/Zarathos94/puffer/models"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// reorgWindow is how far back pending history points are checked against the canonical chain.
+const reorgWindow = 2 * time.Hour
+
+// SetConfirmationDepth sets how many blocks deep a snapshot must be before it is confirmed.
+func (rs *RateService) SetConfirmationDepth(n uint64) {
+	rs.confirmations = n
+}
+
+// SetEventBus sets where reorg and other vault events are published.
+func (rs *RateService) SetEventBus(b *events.Bus) {
+	rs.events = b
+}
+
+// statusFor reports whether a snapshot at block is final given the current head.
+func (rs *RateService) statusFor(block, head uint64) string {
+	if head >= block+rs.confirmations {
+		return models.StatusConfirmed
+	}
+	return models.StatusPending
+}
+
+// CheckReorgs compares the block hash of every pending history point against the
+// canonical header at the same height. Points on an orphaned block are re-read
+// from the canonical block and rewritten; points deep enough are confirmed. A
+// rewritten latest rate is published like a new snapshot.
+func (rs *RateService) CheckReorgs(head uint64) {
+	now := time.Now().Unix()
+	points, err := rs.store.GetHistoricalRates(rs.info.ID, now-int64(reorgWindow/time.Second), now)
+	if err != nil {
+		log.Printf("[Reorg] Failed to load recent history for %s: %v", rs.info.ID, err)
+		return
+	}
+	latest, latestErr := rs.store.GetLatestRate(rs.info.ID)
+	for _, p := range points {
+		if p.Status != models.StatusPending || p.BlockHash == "" {
+			continue
+		}
+		header, err := rs.headerByNumber(p.BlockNumber)
+		if err != nil {
+			log.Printf("[Reorg] Failed to fetch canonical header %d for %s: %v", p.BlockNumber, rs.info.ID, err)
+			continue
+		}
+		updated := p
+		if canonical := header.Hash().Hex(); canonical != p.BlockHash {
+			updated, err = rs.snapshotAt(header, p.Timestamp)
+			if err != nil {
+				log.Printf("[Reorg] Failed to re-read %s at canonical block %d: %v", rs.info.ID, p.BlockNumber, err)
+				continue
+			}
+			log.Printf("[Reorg] %s block %d reorged: %s -> %s", rs.info.ID, p.BlockNumber, p.BlockHash, canonical)
+			rs.events.Publish(models.Event{
+				Type:    models.EventReorg,
+				VaultID: rs.info.ID,
+				Data: models.ReorgEvent{
+					Timestamp:   p.Timestamp,
+					BlockNumber: p.BlockNumber,
+					OldHash:     p.BlockHash,
+					NewHash:     canonical,
+					OldRate:     p.RateDecimal,
+					NewRate:     updated.RateDecimal,
+				},
+			})
+		}
+		updated.Status = rs.statusFor(updated.BlockNumber, head)
+		if updated == p {
+			continue
+		}
+		if err := rs.store.AddHistoricalRate(rs.info.ID, updated); err != nil {
+			log.Printf("[Reorg] Failed to rewrite history for %s at %d: %v", rs.info.ID, p.Timestamp, err)
+		}
+		if latestErr == nil && latest.BlockHash == p.BlockHash {
+			if err := rs.store.SetLatestRate(rs.info.ID, updated); err != nil {
+				log.Printf("[Reorg] Failed to rewrite latest rate for %s: %v", rs.info.ID, err)
+			} else {
+				rs.publishRate(updated)
+			}
+		}
+	}
+}
+
+func (rs *RateService) headerByNumber(n uint64) (*types.Header, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return rs.client.HeaderByNumber(ctx, new(big.Int).SetUint64(n))
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Zarathos94/puffer/events"
+	"github.com/Zarathos94/puffer/models"
+)
+
+func TestCheckReorgsPublishesRewrittenLatest(t *testing.T) {
+	chain := newFakeChain(100, 1_700_000_000, 12)
+	rs := newChainService(t, chain)
+	rs.SetConfirmationDepth(12)
+	bus := events.NewBus()
+	rs.SetEventBus(bus)
+	ch, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	header, _ := chain.HeaderByNumber(context.Background(), nil)
+	now := time.Now().Unix()
+	point, err := rs.snapshotAt(header, now-now%3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point.Status = models.StatusPending
+	rs.store.SetLatestRate("v", point)
+	rs.store.AddHistoricalRate("v", point)
+
+	// nextRate returns the next rate event, skipping the others
+	nextRate := func() models.RateUpdate {
+		t.Helper()
+		for {
+			select {
+			case e := <-ch:
+				if e.Type == models.EventRate {
+					return e.Data.(models.RateUpdate)
+				}
+			default:
+				t.Fatal("no rate event published")
+			}
+		}
+	}
+
+	chain.reorg(point.BlockNumber)
+	rs.CheckReorgs(point.BlockNumber)
+	corrected := nextRate()
+	if corrected.BlockHash == point.BlockHash || corrected.Status != models.StatusPending {
+		t.Fatalf("published %+v, want the canonical hash still pending", corrected)
+	}
+
+	rs.CheckReorgs(point.BlockNumber + 12)
+	if confirmed := nextRate(); confirmed.BlockHash != corrected.BlockHash || confirmed.Status != models.StatusConfirmed {
+		t.Fatalf("published %+v, want the canonical point confirmed", confirmed)
+	}
+	if latest, _ := rs.GetLatest(); latest.Status != models.StatusConfirmed {
+		t.Fatalf("latest = %+v, want confirmed", latest)
+	}
+}
@@ -0,0 +1,334 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// RollupConfig sets how long each history tier is kept. Zero fields use
+// DefaultRollupConfig; daily rollups are kept forever.
+type RollupConfig struct {
+	RawRetention        time.Duration
+	FiveMinuteRetention time.Duration
+	HourlyRetention     time.Duration
+	// CompactEvery is how often recent buckets are recomputed.
+	CompactEvery time.Duration
+}
+
+var DefaultRollupConfig = RollupConfig{
+	RawRetention:        48 * time.Hour,
+	FiveMinuteRetention: 14 * 24 * time.Hour,
+	HourlyRetention:     90 * 24 * time.Hour,
+	CompactEvery:        5 * time.Minute,
+}
+
+// bucketSeconds is the bucket width of each rollup tier.
+var bucketSeconds = map[string]int64{
+	models.Resolution5m: 5 * 60,
+	models.Resolution1h: 3600,
+	models.Resolution1d: 24 * 3600,
+}
+
+// rollupChunk bounds how much history one compaction step loads; it is a multiple of every bucket width.
+const rollupChunk = 30 * 24 * 3600
+
+// SetRollupConfig sets the tier retentions, filling zero fields with the defaults.
+func (rs *RateService) SetRollupConfig(cfg RollupConfig) {
+	if cfg.RawRetention <= 0 {
+		cfg.RawRetention = DefaultRollupConfig.RawRetention
+	}
+	if cfg.FiveMinuteRetention <= 0 {
+		cfg.FiveMinuteRetention = DefaultRollupConfig.FiveMinuteRetention
+	}
+	if cfg.HourlyRetention <= 0 {
+		cfg.HourlyRetention = DefaultRollupConfig.HourlyRetention
+	}
+	if cfg.CompactEvery <= 0 {
+		cfg.CompactEvery = DefaultRollupConfig.CompactEvery
+	}
+	rs.rollups = cfg
+}
+
+// RunCompaction rebuilds the rollups covering the raw window once, then keeps
+// the most recent buckets up to date until ctx is cancelled.
+func (rs *RateService) RunCompaction(ctx context.Context) {
+	if rs.cache == nil {
+		return
+	}
+	if err := rs.Compact(time.Now().Add(-rs.rollups.RawRetention).Unix()); err != nil {
+		log.Printf("[Rollup] Initial compaction for %s failed: %v", rs.info.ID, err)
+	}
+	ticker := time.NewTicker(rs.rollups.CompactEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Look back far enough to finish buckets that were still open last run
+			since := time.Now().Add(-rs.rollups.CompactEvery - time.Hour).Unix()
+			if err := rs.Compact(since); err != nil {
+				log.Printf("[Rollup] Compaction for %s failed: %v", rs.info.ID, err)
+			}
+		}
+	}
+}
+
+// Compact recomputes every rollup bucket from since to now and drops points
+// that have aged out of their tier.
+func (rs *RateService) Compact(since int64) error {
+	now := time.Now().Unix()
+	for _, res := range []string{models.Resolution5m, models.Resolution1h, models.Resolution1d} {
+		if err := rs.rollupRange(res, since, now); err != nil {
+			return err
+		}
+	}
+	return rs.trimTiers(now)
+}
+
+// CompactRange recomputes the hourly and daily rollups for [from, to], e.g.
+// after a backfill has written history there.
+func (rs *RateService) CompactRange(from, to int64) error {
+	if rs.cache == nil {
+		return nil
+	}
+	if err := rs.rollupRange(models.Resolution1h, max(from, time.Now().Add(-rs.rollups.HourlyRetention).Unix()), to); err != nil {
+		return err
+	}
+	return rs.rollupRange(models.Resolution1d, from, to)
+}
+
+func (rs *RateService) trimTiers(now int64) error {
+	tiers := []struct {
+		res       string
+		retention time.Duration
+	}{
+		{models.ResolutionRaw, rs.rollups.RawRetention},
+		{models.Resolution5m, rs.rollups.FiveMinuteRetention},
+		{models.Resolution1h, rs.rollups.HourlyRetention},
+	}
+	for _, t := range tiers {
+		if err := rs.cache.TrimTier(rs.info.ID, t.res, now-int64(t.retention.Seconds())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollupRange recomputes the buckets of one resolution overlapping [from, to].
+// 5m buckets are built from raw snapshots only. 1h buckets merge the 5m
+// rollups and 1d buckets merge the 1h rollups; an hour the finer tier doesn't
+// cover, e.g. one that was backfilled or has aged out of it, is taken from its
+// hourly history point instead, so no sample is counted twice.
+func (rs *RateService) rollupRange(res string, from, to int64) error {
+	size := bucketSeconds[res]
+	for chunk := from - from%size; chunk <= to; chunk += rollupChunk {
+		chunkEnd := min(chunk+rollupChunk-1, to)
+		var rollups []models.RateRollup
+		if res == models.Resolution5m {
+			raw, err := rs.cache.GetRawRates(rs.info.ID, chunk, chunkEnd)
+			if err != nil {
+				return err
+			}
+			for bucket, group := range groupPoints(raw, size) {
+				rollups = append(rollups, buildRollup(res, bucket, group))
+			}
+		} else {
+			finer := models.Resolution5m
+			if res == models.Resolution1d {
+				finer = models.Resolution1h
+			}
+			parts, err := rs.cache.GetRollups(rs.info.ID, finer, chunk, chunkEnd)
+			if err != nil {
+				return err
+			}
+			points, err := rs.store.GetHistoricalRates(rs.info.ID, chunk, chunkEnd)
+			if err != nil {
+				return err
+			}
+			for bucket, group := range groupRollups(fillHours(parts, points), size) {
+				rollups = append(rollups, mergeRollups(res, bucket, group))
+			}
+		}
+		if err := rs.cache.SetRollups(rs.info.ID, res, rollups); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillHours adds a one-sample hourly rollup for every history point whose hour
+// has no rollup in parts.
+func fillHours(parts []models.RateRollup, points []models.RateUpdate) []models.RateRollup {
+	covered := make(map[int64]bool)
+	for _, p := range parts {
+		covered[p.Timestamp-p.Timestamp%3600] = true
+	}
+	for _, p := range points {
+		hour := p.Timestamp - p.Timestamp%3600
+		if !covered[hour] {
+			parts = append(parts, buildRollup(models.Resolution1h, hour, []models.RateUpdate{p}))
+		}
+	}
+	return parts
+}
+
+func groupPoints(points []models.RateUpdate, size int64) map[int64][]models.RateUpdate {
+	groups := make(map[int64][]models.RateUpdate)
+	for _, p := range points {
+		bucket := p.Timestamp - p.Timestamp%size
+		groups[bucket] = append(groups[bucket], p)
+	}
+	return groups
+}
+
+func groupRollups(rollups []models.RateRollup, size int64) map[int64][]models.RateRollup {
+	groups := make(map[int64][]models.RateRollup)
+	for _, r := range rollups {
+		bucket := r.Timestamp - r.Timestamp%size
+		groups[bucket] = append(groups[bucket], r)
+	}
+	return groups
+}
+
+// buildRollup summarizes the points of one bucket.
+func buildRollup(res string, bucket int64, points []models.RateUpdate) models.RateRollup {
+	sort.SliceStable(points, func(i, j int) bool { return blockOrSnapshotTime(points[i]) < blockOrSnapshotTime(points[j]) })
+	r := models.RateRollup{
+		RateUpdate: points[len(points)-1],
+		Resolution: res,
+		Open:       points[0].Rate,
+		High:       points[0].Rate,
+		Low:        points[0].Rate,
+		Close:      points[len(points)-1].Rate,
+		Samples:    len(points),
+	}
+	var sum float64
+	for _, p := range points {
+		r.High = max(r.High, p.Rate)
+		r.Low = min(r.Low, p.Rate)
+		sum += p.Rate
+	}
+	r.Average = sum / float64(len(points))
+	r.Timestamp = bucket
+	return r
+}
+
+// mergeRollups combines finer rollups into one bucket, weighting averages by sample count.
+func mergeRollups(res string, bucket int64, parts []models.RateRollup) models.RateRollup {
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Timestamp < parts[j].Timestamp })
+	r := models.RateRollup{
+		RateUpdate: parts[len(parts)-1].RateUpdate,
+		Resolution: res,
+		Open:       parts[0].Open,
+		High:       parts[0].High,
+		Low:        parts[0].Low,
+		Close:      parts[len(parts)-1].Close,
+	}
+	var weighted float64
+	for _, p := range parts {
+		r.High = max(r.High, p.High)
+		r.Low = min(r.Low, p.Low)
+		weighted += p.Average * float64(p.Samples)
+		r.Samples += p.Samples
+	}
+	if r.Samples > 0 {
+		r.Average = weighted / float64(r.Samples)
+	}
+	r.Timestamp = bucket
+	return r
+}
+
+// ResolutionFor picks the finest tier that still covers [from, to] and keeps
+// the response to a few hundred points.
+func (rs *RateService) ResolutionFor(from, to int64) string {
+	if rs.cache == nil {
+		if to-from <= 90*24*3600 {
+			return models.Resolution1h
+		}
+		return models.Resolution1d
+	}
+	now := time.Now()
+	span := time.Duration(to-from) * time.Second
+	start := time.Unix(from, 0)
+	switch {
+	case span <= 6*time.Hour && start.After(now.Add(-rs.rollups.RawRetention)):
+		return models.ResolutionRaw
+	case span <= 3*24*time.Hour && start.After(now.Add(-rs.rollups.FiveMinuteRetention)):
+		return models.Resolution5m
+	case span <= 90*24*time.Hour && start.After(now.Add(-rs.rollups.HourlyRetention)):
+		return models.Resolution1h
+	}
+	return models.Resolution1d
+}
+
+// GetHistoryAt returns history for [from, to] at a resolution, or at
+// ResolutionFor(from, to) when resolution is empty or "auto". Without Redis
+// only hourly and daily buckets are available, built from the store.
+func (rs *RateService) GetHistoryAt(from, to int64, resolution string) ([]models.RateRollup, error) {
+	if resolution == "" || resolution == "auto" {
+		resolution = rs.ResolutionFor(from, to)
+	}
+	if rs.cache == nil {
+		if resolution == models.ResolutionRaw || resolution == models.Resolution5m {
+			return nil, ErrNoCache
+		}
+		size := bucketSeconds[resolution]
+		return rs.rollupsFromHistory(resolution, from-from%size, to)
+	}
+	if resolution != models.ResolutionRaw {
+		size := bucketSeconds[resolution]
+		rollups, err := rs.cache.GetRollups(rs.info.ID, resolution, from-from%size, to)
+		if err != nil || resolution == models.Resolution5m {
+			return rollups, err
+		}
+		// Hourly and daily buckets before the oldest one in Redis are built from
+		// the hourly history, which the store may hold well past Redis' window
+		end := to
+		if len(rollups) > 0 {
+			end = rollups[0].Timestamp - 1
+		}
+		if end < from-from%size {
+			return rollups, nil
+		}
+		older, err := rs.rollupsFromHistory(resolution, from-from%size, end)
+		if err != nil {
+			return nil, err
+		}
+		return append(older, rollups...), nil
+	}
+	raw, err := rs.cache.GetRawRates(rs.info.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	rollups := make([]models.RateRollup, 0, len(raw))
+	for _, p := range raw {
+		rollups = append(rollups, buildRollup(models.ResolutionRaw, p.Timestamp, []models.RateUpdate{p}))
+	}
+	return rollups, nil
+}
+
+// rollupsFromHistory builds hourly or daily buckets for [from, to] from the
+// store's hourly points alone.
+func (rs *RateService) rollupsFromHistory(res string, from, to int64) ([]models.RateRollup, error) {
+	points, err := rs.store.GetHistoricalRates(rs.info.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var rollups []models.RateRollup
+	for bucket, group := range groupRollups(fillHours(nil, points), bucketSeconds[res]) {
+		rollups = append(rollups, mergeRollups(res, bucket, group))
+	}
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Timestamp < rollups[j].Timestamp })
+	return rollups, nil
+}
+
+// ValidResolution reports whether s names a history tier or "auto".
+func ValidResolution(s string) bool {
+	_, ok := bucketSeconds[s]
+	return ok || s == models.ResolutionRaw || s == "auto" || s == ""
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Zarathos94/puffer/cache"
+	"github.com/Zarathos94/puffer/models"
+)
+
+func TestRollupsDoNotCountHourlyPointsTwice(t *testing.T) {
+	rs := newTestService(t)
+	now := time.Now().Unix()
+	live := now - now%3600 - 3600 // a completed hour with raw snapshots
+	backfilled := live - 3600     // an hour that only has its hourly point
+
+	for i := int64(0); i < 12; i++ {
+		p := models.RateUpdate{Timestamp: live + i*300, Rate: 1 + float64(i)/100, BlockNumber: uint64(100 + i)}
+		if err := rs.cache.AddRawRate("v", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []models.RateUpdate{
+		{Timestamp: backfilled, Rate: 0.5, BlockNumber: 50},
+		{Timestamp: live, Rate: 9, BlockNumber: 111}, // the live hour's closing read
+	} {
+		if err := rs.store.AddHistoricalRate("v", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rs.Compact(backfilled); err != nil {
+		t.Fatal(err)
+	}
+
+	hourly, err := rs.cache.GetRollups("v", models.Resolution1h, backfilled, live)
+	if err != nil || len(hourly) != 2 {
+		t.Fatalf("got %d hourly rollups, %v; want 2", len(hourly), err)
+	}
+	if h := hourly[0]; h.Samples != 1 || h.Close != 0.5 {
+		t.Errorf("backfilled hour = %d samples closing at %v, want 1 sample from its hourly point", h.Samples, h.Close)
+	}
+	if h := hourly[1]; h.Samples != 12 || h.Open != 1 || h.Close != 1.11 || h.High != 1.11 {
+		t.Errorf("live hour = %+v, want the 12 raw samples only", h)
+	}
+
+	day := live - live%86400
+	daily, err := rs.cache.GetRollups("v", models.Resolution1d, day, day)
+	if err != nil || len(daily) != 1 {
+		t.Fatalf("got %d daily rollups, %v", len(daily), err)
+	}
+	// The backfilled hour may fall on the previous day
+	want := 12
+	if backfilled >= day {
+		want = 13
+	}
+	if daily[0].Samples != want {
+		t.Errorf("day has %d samples, want %d", daily[0].Samples, want)
+	}
+}
+
+func TestGetHistoryAtBuildsOlderBucketsFromStore(t *testing.T) {
+	rs := newTestService(t)
+	rs.store = cache.NewMemoryStore()
+	// A year-old day that only the store still has, and a recent hour with a rollup
+	old := time.Now().Add(-365*24*time.Hour).Unix() / 86400 * 86400
+	for h := int64(0); h < 24; h++ {
+		if err := rs.store.AddHistoricalRate("v", models.RateUpdate{Timestamp: old + h*3600, Rate: float64(h), BlockNumber: uint64(h)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recent := time.Now().Unix()/3600*3600 - 3600
+	if err := rs.cache.SetRollups("v", models.Resolution1h, []models.RateRollup{{
+		RateUpdate: models.RateUpdate{Timestamp: recent}, Resolution: models.Resolution1h, Samples: 12,
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	hourly, err := rs.GetHistoryAt(old, recent, models.Resolution1h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hourly) != 25 || hourly[0].Timestamp != old || hourly[23].Close != 23 || hourly[24].Timestamp != recent {
+		t.Fatalf("got %d hourly buckets: first %+v, last %+v", len(hourly), hourly[0], hourly[len(hourly)-1])
+	}
+	daily, err := rs.GetHistoryAt(old, old+86399, models.Resolution1d)
+	if err != nil || len(daily) != 1 || daily[0].Samples != 24 || daily[0].Open != 0 || daily[0].Close != 23 {
+		t.Fatalf("got %+v, %v; want one day of 24 samples", daily, err)
+	}
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Zarathos94/puffer/cache"
+	"github.com/Zarathos94/puffer/models"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestService returns a service for vault "v" backed by an in-process Redis,
+// without a chain client.
+func newTestService(t *testing.T) *RateService {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	c, err := cache.NewCache(mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RateService{
+		info:     models.Vault{ID: "v"},
+		cache:    c,
+		store:    c,
+		detector: NewDetector(DefaultAnomalyConfig),
+		rollups:  DefaultRollupConfig,
+	}
+}
+
+// TestServiceWithoutRedis checks that a service with only a RateStore serves
+// history and reports Redis-backed features as unavailable instead of panicking.
+func TestServiceWithoutRedis(t *testing.T) {
+	store := cache.NewMemoryStore()
+	rs := &RateService{
+		info:     models.Vault{ID: "v"},
+		store:    store,
+		detector: NewDetector(DefaultAnomalyConfig),
+		rollups:  DefaultRollupConfig,
+	}
+	for h := int64(0); h < 48; h++ {
+		if err := store.AddHistoricalRate("v", models.RateUpdate{Timestamp: h * 3600, Rate: 1, BlockNumber: uint64(h)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rs.detectAnomalies(models.RateUpdate{Timestamp: 1, Rate: 1})
+	if err := rs.RecordGap(0, errors.New("rpc down")); err != nil {
+		t.Fatalf("RecordGap = %v, want nil", err)
+	}
+	if _, err := rs.Gaps(0, 3600); !errors.Is(err, ErrNoCache) {
+		t.Fatalf("Gaps = %v, want ErrNoCache", err)
+	}
+	if _, err := rs.Alerts(0, 10); !errors.Is(err, ErrNoCache) {
+		t.Fatalf("Alerts = %v, want ErrNoCache", err)
+	}
+	if _, err := rs.GetHistoryAt(0, 3600, models.Resolution5m); !errors.Is(err, ErrNoCache) {
+		t.Fatalf("GetHistoryAt 5m = %v, want ErrNoCache", err)
+	}
+	days, err := rs.GetHistoryAt(0, 48*3600-1, models.Resolution1d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 2 || days[0].Samples != 24 {
+		t.Fatalf("got %+v, want two daily buckets of 24 hours", days)
+	}
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// WatchStaleness publishes a stale event once each time the latest snapshot's
+// block grows older than maxAge, and again only after it has recovered.
+func (rs *RateService) WatchStaleness(ctx context.Context, maxAge time.Duration) {
+	if maxAge <= 0 {
+		return
+	}
+	interval := maxAge / 4
+	if interval < 10*time.Second {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	stale := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		latest, err := rs.store.GetLatestRate(rs.info.ID)
+		if err != nil {
+			continue
+		}
+		last := blockOrSnapshotTime(latest)
+		age := time.Since(time.Unix(last, 0))
+		if age <= maxAge {
+			if stale {
+				log.Printf("[Staleness] %s is fresh again", rs.info.ID)
+			}
+			stale = false
+			continue
+		}
+		if stale {
+			continue
+		}
+		stale = true
+		log.Printf("[Staleness] %s has not been updated for %s", rs.info.ID, age.Truncate(time.Second))
+		rs.events.Publish(models.Event{
+			Type:    models.EventStale,
+			VaultID: rs.info.ID,
+			Data: models.StaleEvent{
+				LastUpdate: last,
+				Age:        int64(age.Seconds()),
+				MaxAge:     int64(maxAge.Seconds()),
+			},
+		})
+	}
+}
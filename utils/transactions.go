@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zarathos94/puffer/etherscanclient"
+	"github.com/Zarathos94/puffer/models"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// txABI covers the state-changing vault methods whose calldata is decoded: the
+// ERC-4626 and ERC-20 entry points plus PufferVault's ETH and stETH deposits.
+var txABI = mustParseABI(`[
+	{"type":"function","name":"deposit","inputs":[{"name":"assets","type":"uint256"},{"name":"receiver","type":"address"}]},
+	{"type":"function","name":"mint","inputs":[{"name":"shares","type":"uint256"},{"name":"receiver","type":"address"}]},
+	{"type":"function","name":"withdraw","inputs":[{"name":"assets","type":"uint256"},{"name":"receiver","type":"address"},{"name":"owner","type":"address"}]},
+	{"type":"function","name":"redeem","inputs":[{"name":"shares","type":"uint256"},{"name":"receiver","type":"address"},{"name":"owner","type":"address"}]},
+	{"type":"function","name":"depositETH","inputs":[{"name":"receiver","type":"address"}]},
+	{"type":"function","name":"depositStETH","inputs":[{"name":"stETHSharesAmount","type":"uint256"},{"name":"receiver","type":"address"}]},
+	{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}]},
+	{"type":"function","name":"transferFrom","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"amount","type":"uint256"}]},
+	{"type":"function","name":"approve","inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}]},
+	{"type":"function","name":"permit","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"},{"name":"value","type":"uint256"},{"name":"deadline","type":"uint256"},{"name":"v","type":"uint8"},{"name":"r","type":"bytes32"},{"name":"s","type":"bytes32"}]},
+	{"type":"function","name":"upgradeToAndCall","inputs":[{"name":"newImplementation","type":"address"},{"name":"data","type":"bytes"}]}
+]`)
+
+const (
+	DefaultTransactionLimit = 50
+	MaxTransactionLimit     = 1000
+	// Pages that reach the chain head go stale as blocks arrive; closed ranges barely change.
+	openTxPageTTL   = time.Minute
+	closedTxPageTTL = 24 * time.Hour
+)
+
+var (
+	// ErrEtherscanUnavailable is returned by Transactions when no Etherscan client is configured.
+	ErrEtherscanUnavailable = errors.New("etherscan client not configured")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+)
+
+// TransactionQuery selects a page of vault transactions.
+type TransactionQuery struct {
+	FromBlock uint64
+	// ToBlock of zero means up to the chain head.
+	ToBlock uint64
+	// Sort is "asc" or "desc".
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+// SetEtherscan sets the client used to list the vault's transactions.
+func (rs *RateService) SetEtherscan(c *etherscanclient.Client) {
+	rs.etherscan = c
+}
+
+// Transactions returns one page of transactions sent to the vault. Pages are
+// cached in Redis; NextCursor continues from the last transaction returned.
+func (rs *RateService) Transactions(ctx context.Context, q TransactionQuery) (models.TransactionPage, error) {
+	if rs.etherscan == nil {
+		return models.TransactionPage{}, ErrEtherscanUnavailable
+	}
+	if q.Sort != "desc" {
+		q.Sort = "asc"
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultTransactionLimit
+	}
+	if q.Limit > MaxTransactionLimit {
+		q.Limit = MaxTransactionLimit
+	}
+	start, end := q.FromBlock, q.ToBlock
+	if end == 0 {
+		end = etherscanclient.LatestBlock
+	}
+	var after cursor
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return models.TransactionPage{}, err
+		}
+		after = c
+		// Resume from the cursor's block; earlier entries in it are skipped below
+		if q.Sort == "asc" {
+			start = max(start, c.block)
+		} else {
+			end = min(end, c.block)
+		}
+	}
+
+	key := fmt.Sprintf("%d:%d:%s:%d:%s", q.FromBlock, q.ToBlock, q.Sort, q.Limit, q.Cursor)
+	if rs.cache != nil {
+		if page, err := rs.cache.GetTransactionPage(rs.info.ID, key); err == nil {
+			return page, nil
+		}
+	}
+
+	page := models.TransactionPage{Transactions: []models.VaultTransaction{}}
+	skipping := q.Cursor != ""
+	var last models.VaultTransaction
+	txs := rs.etherscan.Transactions(ctx, etherscanclient.TxQuery{
+		Address:    rs.info.Address,
+		StartBlock: start,
+		EndBlock:   end,
+		PageSize:   max(q.Limit+1, 100),
+		Sort:       q.Sort,
+	})
+	for tx, err := range txs {
+		if err != nil {
+			return models.TransactionPage{}, err
+		}
+		vt := decodeTransaction(tx)
+		if skipping {
+			if vt.BlockNumber == after.block {
+				if vt.Hash == after.hash {
+					skipping = false
+				}
+				continue
+			}
+			skipping = false
+		}
+		if len(page.Transactions) == q.Limit {
+			// One more exists, so there is a next page
+			page.NextCursor = encodeCursor(cursor{block: last.BlockNumber, hash: last.Hash})
+			break
+		}
+		page.Transactions = append(page.Transactions, vt)
+		last = vt
+	}
+
+	ttl := openTxPageTTL
+	if q.ToBlock != 0 {
+		ttl = closedTxPageTTL
+	}
+	if rs.cache != nil {
+		if err := rs.cache.SetTransactionPage(rs.info.ID, key, page, ttl); err != nil {
+			log.Printf("[Transactions] Failed to cache page for %s: %v", rs.info.ID, err)
+		}
+	}
+	return page, nil
+}
+
+// cursor points just past a transaction: its block and hash.
+type cursor struct {
+	block uint64
+	hash  string
+}
+
+func encodeCursor(c cursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", c.block, c.hash)))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	block, hash, ok := strings.Cut(string(b), ":")
+	n, err := strconv.ParseUint(block, 10, 64)
+	if !ok || err != nil || hash == "" {
+		return cursor{}, ErrInvalidCursor
+	}
+	return cursor{block: n, hash: hash}, nil
+}
+
+// decodeTransaction converts an Etherscan transaction and decodes its calldata against txABI.
+func decodeTransaction(tx etherscanclient.Transaction) models.VaultTransaction {
+	vt := models.VaultTransaction{
+		Hash:        tx.Hash,
+		BlockNumber: ParseBlockNumber(tx.BlockNumber),
+		From:        tx.From,
+		To:          tx.To,
+		Value:       tx.Value,
+		Failed:      tx.IsError == "1",
+		GasUsed:     tx.GasUsed,
+	}
+	vt.Timestamp, _ = strconv.ParseInt(tx.TimeStamp, 10, 64)
+	input, err := hexutil.Decode(tx.Input)
+	if err != nil || len(input) < 4 {
+		return vt
+	}
+	vt.Selector = hexutil.Encode(input[:4])
+	method, err := txABI.MethodById(input[:4])
+	if err != nil {
+		return vt
+	}
+	vt.Method = method.Name
+	args := make(map[string]interface{})
+	if err := method.Inputs.UnpackIntoMap(args, input[4:]); err != nil {
+		// Keep the method name even if the arguments are malformed
+		return vt
+	}
+	vt.Args = make(map[string]interface{}, len(args))
+	for name, v := range args {
+		vt.Args[name] = jsonArg(v)
+	}
+	return vt
+}
+
+// jsonArg renders decoded ABI values the way the rest of the API does: integers as decimal strings, bytes as hex.
+func jsonArg(v interface{}) interface{} {
+	switch x := v.(type) {
+	case *big.Int:
+		return x.String()
+	case common.Address:
+		return x.Hex()
+	case []byte:
+		return hexutil.Encode(x)
+	case [32]byte:
+		return hexutil.Encode(x[:])
+	}
+	return v
+}
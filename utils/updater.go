@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	// resubscribeAfter is how long the block updater polls before retrying the subscription.
+	resubscribeAfter = time.Minute
+	// headTimeoutFactor times the poll interval without a new head counts as a dropped subscription.
+	headTimeoutFactor = 4
+)
+
+// RunPollUpdater snapshots the vault every interval until ctx is cancelled.
+// afterSnapshot, if set, runs after each snapshot.
+func (rs *RateService) RunPollUpdater(ctx context.Context, interval time.Duration, afterSnapshot func()) {
+	for {
+		rs.FetchAndUpdate()
+		if afterSnapshot != nil {
+			afterSnapshot()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// RunBlockUpdater snapshots the vault on every Nth head received from a newHeads
+// subscription over wsURL. While the subscription is down it polls every
+// pollInterval and retries the subscription once a minute.
+func (rs *RateService) RunBlockUpdater(ctx context.Context, wsURL string, everyN uint64, pollInterval time.Duration, afterSnapshot func()) {
+	if everyN == 0 {
+		everyN = 1
+	}
+	for ctx.Err() == nil {
+		err := rs.followHeads(ctx, wsURL, everyN, pollInterval*headTimeoutFactor, afterSnapshot)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[Updater] newHeads subscription for %s dropped: %v; polling every %s", rs.info.ID, err, pollInterval)
+		pollCtx, cancel := context.WithTimeout(ctx, resubscribeAfter)
+		rs.RunPollUpdater(pollCtx, pollInterval, afterSnapshot)
+		cancel()
+	}
+}
+
+// followHeads snapshots on new heads until the subscription fails or stalls.
+func (rs *RateService) followHeads(ctx context.Context, wsURL string, everyN uint64, headTimeout time.Duration, afterSnapshot func()) error {
+	client, err := ethclient.DialContext(ctx, wsURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	heads := make(chan *types.Header, 16)
+	sub, err := client.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	log.Printf("[Updater] Subscribed to newHeads for %s (every %d blocks)", rs.info.ID, everyN)
+	timer := time.NewTimer(headTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return err
+		case <-timer.C:
+			return fmt.Errorf("no new head for %s", headTimeout)
+		case header := <-heads:
+			timer.Reset(headTimeout)
+			if header.Number.Uint64()%everyN != 0 {
+				continue
+			}
+			rs.FetchAndUpdateAt(header)
+			if afterSnapshot != nil {
+				afterSnapshot()
+			}
+		}
+	}
+}
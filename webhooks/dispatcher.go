@@ -0,0 +1,308 @@
+// Package webhooks delivers vault events to subscribed HTTP endpoints.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Zarathos94/puffer/events"
+	"github.com/Zarathos94/puffer/models"
+)
+
+// Store persists subscriptions and delivery outcomes. *cache.Cache implements it.
+type Store interface {
+	ListWebhooks() ([]models.WebhookSubscription, error)
+	LogDelivery(d models.WebhookDelivery) error
+	AddDeadLetter(dl models.DeadLetter) error
+}
+
+// Options tunes delivery. Zero fields use the defaults.
+type Options struct {
+	// Client sends deliveries; its Timeout bounds each attempt.
+	Client *http.Client
+	// MaxAttempts is how many times a delivery is tried before it is dead-lettered.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry; it doubles on each retry up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+const (
+	defaultMaxAttempts = 6
+	defaultBaseBackoff = 2 * time.Second
+	defaultMaxBackoff  = 5 * time.Minute
+	defaultTimeout     = 10 * time.Second
+)
+
+// Dispatcher turns bus events into signed webhook deliveries.
+type Dispatcher struct {
+	store Store
+	opts  Options
+
+	mu       sync.Mutex
+	lastRate map[string]*big.Rat // per vault, for threshold crossings
+	wg       sync.WaitGroup
+}
+
+func NewDispatcher(store Store, opts Options) *Dispatcher {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: defaultTimeout}
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = defaultBaseBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	return &Dispatcher{store: store, opts: opts, lastRate: make(map[string]*big.Rat)}
+}
+
+// Run dispatches events from bus until ctx is cancelled. It subscribes with
+// SubscribeBlocking, so a burst of events delays publishers instead of being lost.
+func (d *Dispatcher) Run(ctx context.Context, bus *events.Bus) {
+	ch, unsubscribe := bus.SubscribeBlocking()
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-ch:
+			d.Dispatch(ctx, e)
+		}
+	}
+}
+
+// Wait blocks until every in-flight delivery has finished or been dead-lettered.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Dispatch starts a delivery to every subscription interested in e.
+func (d *Dispatcher) Dispatch(ctx context.Context, e models.Event) {
+	if e.Type == models.EventRate {
+		d.dispatchThresholds(ctx, e)
+		return
+	}
+	eventType := webhookType(e.Type)
+	if eventType == "" {
+		return
+	}
+	subs, err := d.store.ListWebhooks()
+	if err != nil {
+		log.Printf("[Webhooks] Failed to load subscriptions: %v", err)
+		return
+	}
+	for _, sub := range subs {
+		if wants(sub, eventType, e.VaultID) {
+			d.Send(ctx, sub, newPayload(eventType, e.VaultID, e.Time, e.Data))
+		}
+	}
+}
+
+// webhookType maps a bus event type to the webhook event type it is delivered as.
+func webhookType(busType string) string {
+	switch busType {
+	case models.EventAlert:
+		return models.WebhookRateAnomaly
+	case models.EventStale:
+		return models.WebhookStaleness
+	case models.EventUpgrade:
+		return models.WebhookProxyUpgrade
+	case models.EventReorg:
+		return models.WebhookReorg
+	}
+	return ""
+}
+
+// dispatchThresholds compares a rate update with the vault's previous rate and
+// notifies subscriptions whose thresholds lie between the two.
+func (d *Dispatcher) dispatchThresholds(ctx context.Context, e models.Event) {
+	u, ok := e.Data.(models.RateUpdate)
+	if !ok {
+		return
+	}
+	cur := exactRate(u)
+	if cur == nil {
+		return
+	}
+	d.mu.Lock()
+	prev := d.lastRate[e.VaultID]
+	d.lastRate[e.VaultID] = cur
+	d.mu.Unlock()
+	if prev == nil || prev.Cmp(cur) == 0 {
+		return
+	}
+	subs, err := d.store.ListWebhooks()
+	if err != nil {
+		log.Printf("[Webhooks] Failed to load subscriptions: %v", err)
+		return
+	}
+	for _, sub := range subs {
+		if !wants(sub, models.WebhookThresholdCrossing, e.VaultID) {
+			continue
+		}
+		for _, t := range sub.RateThresholds {
+			threshold, ok := new(big.Rat).SetString(t)
+			if !ok {
+				continue
+			}
+			direction := ""
+			switch {
+			case prev.Cmp(threshold) < 0 && cur.Cmp(threshold) >= 0:
+				direction = "up"
+			case prev.Cmp(threshold) >= 0 && cur.Cmp(threshold) < 0:
+				direction = "down"
+			default:
+				continue
+			}
+			d.Send(ctx, sub, newPayload(models.WebhookThresholdCrossing, e.VaultID, e.Time, models.ThresholdCrossing{
+				Threshold:   t,
+				Direction:   direction,
+				PrevRate:    prev.FloatString(18),
+				Rate:        cur.FloatString(18),
+				BlockNumber: u.BlockNumber,
+			}))
+		}
+	}
+}
+
+// exactRate prefers the exact decimal rate over the float one.
+func exactRate(u models.RateUpdate) *big.Rat {
+	if u.RateDecimal != "" {
+		if r, ok := new(big.Rat).SetString(u.RateDecimal); ok {
+			return r
+		}
+	}
+	if u.Rate == 0 {
+		return nil
+	}
+	return new(big.Rat).SetFloat64(u.Rate)
+}
+
+func newPayload(eventType, vaultID string, ts int64, data interface{}) models.WebhookPayload {
+	if ts == 0 {
+		ts = time.Now().Unix()
+	}
+	return models.WebhookPayload{ID: randomHex(12), Type: eventType, VaultID: vaultID, Time: ts, Data: data}
+}
+
+// Send delivers payload to sub in the background, retrying with exponential
+// backoff and dead-lettering it once MaxAttempts is exhausted.
+func (d *Dispatcher) Send(ctx context.Context, sub models.WebhookSubscription, p models.WebhookPayload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("[Webhooks] Failed to encode %s payload: %v", p.Type, err)
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deliver(ctx, sub, p, body)
+	}()
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, sub models.WebhookSubscription, p models.WebhookPayload, body []byte) {
+	var lastErr error
+	attempt := 1
+	for ; ; attempt++ {
+		start := time.Now()
+		status, err := d.post(ctx, sub, p, body)
+		entry := models.WebhookDelivery{
+			DeliveryID:     p.ID,
+			SubscriptionID: sub.ID,
+			EventType:      p.Type,
+			Attempt:        attempt,
+			Status:         models.DeliveryDelivered,
+			StatusCode:     status,
+			DurationMs:     time.Since(start).Milliseconds(),
+			Timestamp:      start.Unix(),
+		}
+		if err == nil {
+			d.logDelivery(entry)
+			return
+		}
+		lastErr = err
+		entry.Error = err.Error()
+		entry.Status = models.DeliveryRetrying
+		if attempt >= d.opts.MaxAttempts {
+			entry.Status = models.DeliveryDead
+		}
+		d.logDelivery(entry)
+		if attempt >= d.opts.MaxAttempts {
+			break
+		}
+		timer := time.NewTimer(d.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			lastErr = ctx.Err()
+		case <-timer.C:
+			continue
+		}
+		break
+	}
+	log.Printf("[Webhooks] Giving up on %s delivery %s to %s after %d attempts: %v", p.Type, p.ID, sub.ID, attempt, lastErr)
+	dl := models.DeadLetter{
+		SubscriptionID: sub.ID,
+		URL:            sub.URL,
+		Payload:        p,
+		Attempts:       attempt,
+		LastError:      lastErr.Error(),
+		Timestamp:      time.Now().Unix(),
+	}
+	if err := d.store.AddDeadLetter(dl); err != nil {
+		log.Printf("[Webhooks] Failed to store dead letter %s: %v", p.ID, err)
+	}
+}
+
+// post makes one signed delivery attempt. Any non-2xx response is an error.
+func (d *Dispatcher) post(ctx context.Context, sub models.WebhookSubscription, p models.WebhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, p.Type)
+	req.Header.Set(HeaderDelivery, p.ID)
+	req.Header.Set(HeaderTimestamp, fmt.Sprint(ts))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, ts, body))
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after a failed attempt: BaseBackoff doubled per
+// attempt, capped at MaxBackoff, with up to 20% jitter.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.opts.BaseBackoff << (attempt - 1)
+	if delay <= 0 || delay > d.opts.MaxBackoff {
+		delay = d.opts.MaxBackoff
+	}
+	return delay + time.Duration(rand.Int64N(int64(delay)/5+1))
+}
+
+func (d *Dispatcher) logDelivery(entry models.WebhookDelivery) {
+	if err := d.store.LogDelivery(entry); err != nil {
+		log.Printf("[Webhooks] Failed to log delivery %s: %v", entry.DeliveryID, err)
+	}
+}
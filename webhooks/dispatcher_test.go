@@ -0,0 +1,111 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// memStore is a Store kept in memory.
+type memStore struct {
+	mu         sync.Mutex
+	subs       []models.WebhookSubscription
+	deliveries []models.WebhookDelivery
+	dead       []models.DeadLetter
+}
+
+func (s *memStore) ListWebhooks() ([]models.WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.WebhookSubscription(nil), s.subs...), nil
+}
+
+func (s *memStore) LogDelivery(d models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries = append(s.deliveries, d)
+	return nil
+}
+
+func (s *memStore) AddDeadLetter(dl models.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dead = append(s.dead, dl)
+	return nil
+}
+
+// newEndpoint starts a server that verifies every delivery's signature and
+// answers the first failures requests with 500.
+func newEndpoint(t *testing.T, secret string, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify(secret, r.Header.Get(HeaderSignature), r.Header.Get(HeaderTimestamp), body, time.Minute) {
+			t.Errorf("delivery %s has a bad signature", r.Header.Get(HeaderDelivery))
+		}
+		if r.Header.Get(HeaderEvent) != models.WebhookRateAnomaly {
+			t.Errorf("event header = %q", r.Header.Get(HeaderEvent))
+		}
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestDispatcherRetriesSignedDeliveries(t *testing.T) {
+	srv, calls := newEndpoint(t, "s3cret", 2)
+	store := &memStore{subs: []models.WebhookSubscription{{
+		ID: "sub", URL: srv.URL, Secret: "s3cret", EventTypes: []string{models.WebhookRateAnomaly},
+	}}}
+	d := NewDispatcher(store, Options{MaxAttempts: 5, BaseBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	d.Dispatch(context.Background(), models.Event{Type: models.EventAlert, VaultID: "v", Data: "jump"})
+	d.Wait()
+
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("endpoint called %d times, want 3", n)
+	}
+	want := []string{models.DeliveryRetrying, models.DeliveryRetrying, models.DeliveryDelivered}
+	if len(store.deliveries) != len(want) {
+		t.Fatalf("logged %d attempts, want %d", len(store.deliveries), len(want))
+	}
+	for i, entry := range store.deliveries {
+		if entry.Status != want[i] || entry.Attempt != i+1 || entry.DeliveryID != store.deliveries[0].DeliveryID {
+			t.Fatalf("attempt %d logged as %+v", i+1, entry)
+		}
+	}
+	if len(store.dead) != 0 {
+		t.Fatalf("unexpected dead letters: %+v", store.dead)
+	}
+}
+
+func TestDispatcherDeadLettersAfterMaxAttempts(t *testing.T) {
+	srv, calls := newEndpoint(t, "s3cret", 1000)
+	store := &memStore{subs: []models.WebhookSubscription{{
+		ID: "sub", URL: srv.URL, Secret: "s3cret", EventTypes: []string{models.WebhookRateAnomaly},
+	}}}
+	d := NewDispatcher(store, Options{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	d.Dispatch(context.Background(), models.Event{Type: models.EventAlert, VaultID: "v", Data: "jump"})
+	d.Wait()
+
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("endpoint called %d times, want 3", n)
+	}
+	if len(store.dead) != 1 || store.dead[0].Attempts != 3 || store.dead[0].SubscriptionID != "sub" {
+		t.Fatalf("dead letters = %+v, want one after 3 attempts", store.dead)
+	}
+	if last := store.deliveries[len(store.deliveries)-1]; last.Status != models.DeliveryDead || last.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("last attempt logged as %+v", last)
+	}
+}
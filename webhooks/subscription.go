@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Zarathos94/puffer/models"
+)
+
+// NewSubscription validates a subscription request and fills in its ID,
+// creation time and, when none is given, a random signing secret.
+func NewSubscription(sub models.WebhookSubscription) (models.WebhookSubscription, error) {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return sub, fmt.Errorf("url must be an absolute http(s) URL")
+	}
+	if len(sub.EventTypes) == 0 {
+		return sub, fmt.Errorf("event_types must not be empty")
+	}
+	for _, t := range sub.EventTypes {
+		if !slices.Contains(models.WebhookEventTypes, t) {
+			return sub, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	for _, t := range sub.RateThresholds {
+		if _, ok := new(big.Rat).SetString(t); !ok {
+			return sub, fmt.Errorf("invalid rate threshold %q", t)
+		}
+	}
+	if len(sub.RateThresholds) > 0 && !slices.Contains(sub.EventTypes, models.WebhookThresholdCrossing) {
+		sub.EventTypes = append(sub.EventTypes, models.WebhookThresholdCrossing)
+	}
+	if sub.Secret == "" {
+		sub.Secret = randomHex(32)
+	}
+	sub.ID = randomHex(8)
+	sub.CreatedAt = time.Now().Unix()
+	return sub, nil
+}
+
+// wants reports whether sub should receive an event of this type for vaultID.
+func wants(sub models.WebhookSubscription, eventType, vaultID string) bool {
+	if !slices.Contains(sub.EventTypes, eventType) {
+		return false
+	}
+	return len(sub.VaultIDs) == 0 || slices.Contains(sub.VaultIDs, vaultID)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}